@@ -0,0 +1,112 @@
+//go:generate protoc -I pb --go_out=pb --go_opt=paths=source_relative --go-grpc_out=pb --go-grpc_opt=paths=source_relative pb/parser.proto
+
+package grpcserver
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dungnh3/trustwallet-assignment/grpcserver/pb"
+	"github.com/dungnh3/trustwallet-assignment/internal/parser"
+	"github.com/dungnh3/trustwallet-assignment/internal/utils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Register exposes p as the ParserService on s.
+func Register(s *grpc.Server, p parser.Parser) {
+	pb.RegisterParserServiceServer(s, &service{parser: p})
+}
+
+type service struct {
+	pb.UnimplementedParserServiceServer
+	parser parser.Parser
+}
+
+func (s *service) GetCurrentBlock(ctx context.Context, req *pb.GetCurrentBlockRequest) (*pb.GetCurrentBlockResponse, error) {
+	block, err := s.parser.CurrentBlockContext(ctx)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.GetCurrentBlockResponse{Block: int64(block)}, nil
+}
+
+func (s *service) GetTransactions(ctx context.Context, req *pb.GetTransactionsRequest) (*pb.GetTransactionsResponse, error) {
+	if err := validateAddress(req.GetAddress()); err != nil {
+		return nil, err
+	}
+	transactions, err := s.parser.TransactionsContext(ctx, req.GetAddress())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	resp := &pb.GetTransactionsResponse{
+		Transactions: make([]*pb.Transaction, 0, len(transactions)),
+	}
+	for _, trans := range transactions {
+		resp.Transactions = append(resp.Transactions, toTransaction(trans))
+	}
+	return resp, nil
+}
+
+func (s *service) Subscribe(ctx context.Context, req *pb.SubscribeRequest) (*pb.SubscribeResponse, error) {
+	if err := validateAddress(req.GetAddress()); err != nil {
+		return nil, err
+	}
+	return &pb.SubscribeResponse{Subscribed: s.parser.Subscribe(req.GetAddress())}, nil
+}
+
+func (s *service) Unsubscribe(ctx context.Context, req *pb.UnsubscribeRequest) (*pb.UnsubscribeResponse, error) {
+	if err := validateAddress(req.GetAddress()); err != nil {
+		return nil, err
+	}
+	if !s.parser.Unsubscribe(req.GetAddress()) {
+		return nil, status.Error(codes.NotFound, "address is not subscribed")
+	}
+	return &pb.UnsubscribeResponse{Unsubscribed: true}, nil
+}
+
+// toStatus maps parser errors to gRPC statuses.
+func toStatus(err error) error {
+	var callErr *parser.CallError
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, parser.ErrBlockNotFound), errors.Is(err, parser.ErrTransactionNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.As(err, &callErr):
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+func validateAddress(address string) error {
+	if !utils.IsHexAddress(address) {
+		return status.Error(codes.InvalidArgument, "invalid address")
+	}
+	return nil
+}
+
+func toTransaction(trans parser.Transaction) *pb.Transaction {
+	return &pb.Transaction{
+		Type:             trans.Type,
+		BlockHash:        trans.BlockHash,
+		BlockNumber:      trans.BlockNumber,
+		From:             trans.From,
+		To:               trans.To,
+		Gas:              trans.Gas,
+		Hash:             trans.Hash,
+		Input:            trans.Input,
+		Nonce:            trans.Nonce,
+		TransactionIndex: trans.TransactionIndex,
+		Value:            trans.Value,
+		V:                trans.V,
+		R:                trans.R,
+		S:                trans.S,
+		GasPrice:         trans.GasPrice,
+		ChainId:          trans.ChainID,
+	}
+}
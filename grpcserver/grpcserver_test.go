@@ -0,0 +1,76 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dungnh3/trustwallet-assignment/grpcserver/pb"
+	"github.com/dungnh3/trustwallet-assignment/internal/parser"
+	"github.com/dungnh3/trustwallet-assignment/internal/parser/testutil"
+	"github.com/dungnh3/trustwallet-assignment/internal/repositories"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const testAddress = "0x00000000000000000000000000000000000000ab"
+
+func newTestService(t *testing.T) (*service, *testutil.Server) {
+	t.Helper()
+	rpc := testutil.NewServer(t)
+	rpc.Result("eth_blockNumber", "0x10")
+	rpc.Result("eth_getBlockByNumber", nil)
+	p := parser.New(context.Background(), rpc.URL, repositories.New(), parser.WithInterval(time.Hour)).(*parser.Invoker)
+	t.Cleanup(func() { p.Close() })
+	return &service{parser: p}, rpc
+}
+
+func TestToStatus(t *testing.T) {
+	cases := []struct {
+		err      error
+		expected codes.Code
+	}{
+		{context.Canceled, codes.Canceled},
+		{fmt.Errorf("poll: %w", context.DeadlineExceeded), codes.DeadlineExceeded},
+		{fmt.Errorf("block 0x1: %w", parser.ErrBlockNotFound), codes.NotFound},
+		{fmt.Errorf("0xaa: %w", parser.ErrTransactionNotFound), codes.NotFound},
+		{&parser.CallError{Method: "eth_blockNumber", Err: errors.New("connection refused")}, codes.Unavailable},
+		{errors.New("boom"), codes.Internal},
+	}
+	for _, c := range cases {
+		if code := status.Code(toStatus(c.err)); code != c.expected {
+			t.Errorf("%v: expected %s, got %s", c.err, c.expected, code)
+		}
+	}
+}
+
+func TestService(t *testing.T) {
+	s, rpc := newTestService(t)
+	ctx := context.Background()
+
+	block, err := s.GetCurrentBlock(ctx, &pb.GetCurrentBlockRequest{})
+	if err != nil || block.GetBlock() != 16 {
+		t.Errorf("expected block 16, got %v, %v", block, err)
+	}
+
+	sub, err := s.Subscribe(ctx, &pb.SubscribeRequest{Address: testAddress})
+	if err != nil || !sub.GetSubscribed() {
+		t.Errorf("expected the address to be subscribed, got %v, %v", sub, err)
+	}
+	if _, err := s.Unsubscribe(ctx, &pb.UnsubscribeRequest{Address: testAddress}); err != nil {
+		t.Errorf("expected the address to be unsubscribed, got %v", err)
+	}
+	if _, err := s.Unsubscribe(ctx, &pb.UnsubscribeRequest{Address: testAddress}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound unsubscribing twice, got %v", err)
+	}
+	if _, err := s.GetTransactions(ctx, &pb.GetTransactionsRequest{Address: "0xnope"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for an invalid address, got %v", err)
+	}
+
+	rpc.Fail("eth_blockNumber", -32000, "unavailable")
+	if _, err := s.GetCurrentBlock(ctx, &pb.GetCurrentBlockRequest{}); status.Code(err) != codes.Unavailable {
+		t.Errorf("expected Unavailable when the node fails, got %v", err)
+	}
+}
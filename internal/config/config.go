@@ -0,0 +1,174 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	StorageMemory = "memory"
+)
+
+const (
+	defaultRPCHost         = "https://cloudflare-eth.com"
+	defaultPollInterval    = 5 * time.Second
+	defaultServerAddr      = ":8080"
+	defaultStorageBackend  = StorageMemory
+	defaultShutdownTimeout = 10 * time.Second
+	defaultStartupTimeout  = 5 * time.Second
+	defaultRateBurst       = 10
+)
+
+// Config holds the runtime configuration of the service.
+type Config struct {
+	RPCHost         string
+	PollInterval    time.Duration
+	ServerAddr      string
+	GRPCAddr        string
+	StorageBackend  string
+	StorageDSN      string
+	ShutdownTimeout time.Duration
+	StartupTimeout  time.Duration
+	RateLimit       float64
+	RateBurst       int
+	Retention       time.Duration
+}
+
+// Load reads the configuration from the environment, applies any overrides
+// given in args (usually os.Args[1:]) and validates the result.
+func Load(args []string) (*Config, error) {
+	cfg := &Config{
+		RPCHost:        envString("RPC_HOST", defaultRPCHost),
+		ServerAddr:     envString("SERVER_ADDR", defaultServerAddr),
+		GRPCAddr:       envString("GRPC_ADDR", ""),
+		StorageBackend: envString("STORAGE_BACKEND", defaultStorageBackend),
+		StorageDSN:     envString("STORAGE_DSN", ""),
+	}
+
+	var err error
+	if cfg.PollInterval, err = envDuration("POLL_INTERVAL", defaultPollInterval); err != nil {
+		return nil, err
+	}
+	if cfg.ShutdownTimeout, err = envDuration("SHUTDOWN_TIMEOUT", defaultShutdownTimeout); err != nil {
+		return nil, err
+	}
+	if cfg.StartupTimeout, err = envDuration("STARTUP_TIMEOUT", defaultStartupTimeout); err != nil {
+		return nil, err
+	}
+	if cfg.RateLimit, err = envFloat("RATE_LIMIT", 0); err != nil {
+		return nil, err
+	}
+	if cfg.RateBurst, err = envInt("RATE_BURST", defaultRateBurst); err != nil {
+		return nil, err
+	}
+	if cfg.Retention, err = envDuration("RETENTION", 0); err != nil {
+		return nil, err
+	}
+
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.StringVar(&cfg.RPCHost, "rpc-host", cfg.RPCHost, "JSON-RPC endpoint of the node (env RPC_HOST)")
+	fs.DurationVar(&cfg.PollInterval, "poll-interval", cfg.PollInterval, "interval between subscription polls (env POLL_INTERVAL)")
+	fs.StringVar(&cfg.ServerAddr, "server-addr", cfg.ServerAddr, "address the HTTP server listens on (env SERVER_ADDR)")
+	fs.StringVar(&cfg.GRPCAddr, "grpc-addr", cfg.GRPCAddr, "address the gRPC server listens on, disabled when empty (env GRPC_ADDR)")
+	fs.StringVar(&cfg.StorageBackend, "storage-backend", cfg.StorageBackend, "storage backend to use (env STORAGE_BACKEND)")
+	fs.StringVar(&cfg.StorageDSN, "storage-dsn", cfg.StorageDSN, "connection string of the storage backend (env STORAGE_DSN)")
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", cfg.ShutdownTimeout, "time to wait for in-flight requests to drain on shutdown (env SHUTDOWN_TIMEOUT)")
+	fs.DurationVar(&cfg.StartupTimeout, "startup-timeout", cfg.StartupTimeout, "time allowed for the startup self-test (env STARTUP_TIMEOUT)")
+	fs.Float64Var(&cfg.RateLimit, "rate-limit", cfg.RateLimit, "requests per second allowed per client, 0 disables (env RATE_LIMIT)")
+	fs.IntVar(&cfg.RateBurst, "rate-burst", cfg.RateBurst, "burst of requests allowed per client (env RATE_BURST)")
+	fs.DurationVar(&cfg.Retention, "retention", cfg.Retention, "age after which recorded transactions are deleted, 0 keeps them (env RETENTION)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate reports the first invalid or missing setting of c.
+func (c *Config) Validate() error {
+	if c.RPCHost == "" {
+		return errors.New("RPC_HOST is required")
+	}
+	u, err := url.Parse(c.RPCHost)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("RPC_HOST %q must be an absolute http(s) URL", c.RPCHost)
+	}
+	if c.PollInterval <= 0 {
+		return fmt.Errorf("POLL_INTERVAL %s must be positive", c.PollInterval)
+	}
+	if c.ServerAddr == "" {
+		return errors.New("SERVER_ADDR is required")
+	}
+	switch c.StorageBackend {
+	case StorageMemory:
+	default:
+		return fmt.Errorf("STORAGE_BACKEND %q is not supported", c.StorageBackend)
+	}
+	if c.ShutdownTimeout <= 0 {
+		return fmt.Errorf("SHUTDOWN_TIMEOUT %s must be positive", c.ShutdownTimeout)
+	}
+	if c.StartupTimeout <= 0 {
+		return fmt.Errorf("STARTUP_TIMEOUT %s must be positive", c.StartupTimeout)
+	}
+	if c.RateLimit < 0 {
+		return fmt.Errorf("RATE_LIMIT %v must not be negative", c.RateLimit)
+	}
+	if c.RateLimit > 0 && c.RateBurst < 1 {
+		return fmt.Errorf("RATE_BURST %d must be at least 1", c.RateBurst)
+	}
+	if c.Retention < 0 {
+		return fmt.Errorf("RETENTION %s must not be negative", c.Retention)
+	}
+	return nil
+}
+
+func envString(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
+func envDuration(key string, fallback time.Duration) (time.Duration, error) {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, value, err)
+	}
+	return d, nil
+}
+
+func envFloat(key string, fallback float64) (float64, error) {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, value, err)
+	}
+	return f, nil
+}
+
+func envInt(key string, fallback int) (int, error) {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, value, err)
+	}
+	return i, nil
+}
@@ -3,14 +3,28 @@ package models
 import "time"
 
 type BlockInfo struct {
-	BlockAddress             string `json:"block_address,omitempty"`
+	BlockAddress string `json:"block_address,omitempty"`
+	// Count is the number of transactions recorded since the subscription,
+	// which the retention does not lower: it exceeds the number of stored
+	// transactions once old ones are deleted.
 	Count                    int    `json:"count,omitempty"`
 	LatestTransactionAddress string `json:"latest_transaction_address,omitempty"`
+	LastProcessedBlock       int    `json:"last_processed_block,omitempty"`
+}
+
+// BlockRecord is a block processed by the parser, kept to detect chain
+// reorganizations.
+type BlockRecord struct {
+	Number     int       `json:"number"`
+	Hash       string    `json:"hash,omitempty"`
+	ParentHash string    `json:"parent_hash,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
 }
 
 type BlockTransaction struct {
 	ID                 int       `json:"id"`
 	BlockAddress       string    `json:"block_address,omitempty"`
 	TransactionAddress string    `json:"transaction_address,omitempty"`
+	Direction          string    `json:"direction,omitempty"`
 	CreatedAt          time.Time `json:"created_at"`
 }
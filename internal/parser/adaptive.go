@@ -0,0 +1,63 @@
+package parser
+
+import (
+	"sync"
+	"time"
+)
+
+// adaptiveAlpha is the weight of the latest block time in its moving average.
+const adaptiveAlpha = 0.2
+
+// adaptiveInterval estimates the block time of the chain from the heights
+// seen by the poll loop, as the exponential moving average of the time
+// between two new blocks, for the poll interval to follow it within
+// [min, max], see WithAdaptivePolling.
+//
+// Each poll seeing k new blocks after dt contributes a sample of dt/k, so
+// that an interval longer than the block time, seeing several blocks per
+// poll, still measures it. Polls seeing no new block contribute nothing. The
+// average moves by adaptiveAlpha of the gap to each sample: it is within 10%
+// of a steady block time after about 10 samples, and the interval settles
+// at it unless bounded. Samples are quantized by the interval itself, so the
+// estimate of a chain faster than min stays at min.
+type adaptiveInterval struct {
+	min, max time.Duration
+
+	mutex      sync.Mutex
+	lastHeight int
+	lastSeen   time.Time
+	average    time.Duration
+}
+
+func newAdaptiveInterval(min, max time.Duration) *adaptiveInterval {
+	return &adaptiveInterval{min: min, max: max}
+}
+
+// observe records height seen at now and returns the poll interval, false
+// until a first block time is measured.
+func (a *adaptiveInterval) observe(height int, now time.Time) (time.Duration, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.lastSeen.IsZero() || height < a.lastHeight {
+		// first poll, or a node behind the previous one
+		a.lastHeight, a.lastSeen = height, now
+		return 0, false
+	}
+	if height == a.lastHeight {
+		return a.interval(), a.average > 0
+	}
+
+	sample := now.Sub(a.lastSeen) / time.Duration(height-a.lastHeight)
+	a.lastHeight, a.lastSeen = height, now
+	if a.average == 0 {
+		a.average = sample
+	} else {
+		a.average += time.Duration(adaptiveAlpha * float64(sample-a.average))
+	}
+	return a.interval(), true
+}
+
+// interval returns the average block time bounded by min and max.
+func (a *adaptiveInterval) interval() time.Duration {
+	return min(max(a.average, a.min), a.max)
+}
@@ -0,0 +1,49 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/dungnh3/trustwallet-assignment/internal/utils"
+)
+
+// BlockTag identifies a block either by its hex number, see BlockNumberTag,
+// or by one of the Latest, Earliest and Pending tags.
+type BlockTag string
+
+const (
+	Latest   BlockTag = "latest"
+	Earliest BlockTag = "earliest"
+	Pending  BlockTag = "pending"
+)
+
+// BlockNumberTag returns the tag of the block at number.
+func BlockNumberTag(number int) BlockTag {
+	return BlockTag(fmt.Sprintf("%#x", number))
+}
+
+// Number returns the block number of t, or false when t is a named tag or
+// a number overflowing an int.
+func (t BlockTag) Number() (int, bool) {
+	if !utils.IsHex(string(t)) {
+		return 0, false
+	}
+	number, err := strconv.ParseInt(string(t)[2:], 16, 0)
+	if err != nil {
+		return 0, false
+	}
+	return int(number), true
+}
+
+// Validate reports an error unless t is a hex number fitting an int or a
+// known tag.
+func (t BlockTag) Validate() error {
+	switch t {
+	case Latest, Earliest, Pending:
+		return nil
+	}
+	if _, ok := t.Number(); !ok {
+		return fmt.Errorf("%q: %w", t, ErrInvalidBlockTag)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package parser
+
+import (
+	"sync"
+	"time"
+)
+
+// blockCache keeps the blocks fetched during the current poll cycle so
+// subscriptions scanning the same block share a single RPC call. Entries
+// expire after one poll interval.
+type blockCache struct {
+	mutex   sync.Mutex
+	ttl     time.Duration
+	entries map[int]blockCacheEntry
+}
+
+type blockCacheEntry struct {
+	block     *FullBlockResult
+	fetchedAt time.Time
+}
+
+func newBlockCache(ttl time.Duration) *blockCache {
+	return &blockCache{
+		ttl:     ttl,
+		entries: make(map[int]blockCacheEntry),
+	}
+}
+
+func (c *blockCache) setTTL(ttl time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.ttl = ttl
+}
+
+func (c *blockCache) get(number int) (*FullBlockResult, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, ok := c.entries[number]
+	if !ok || time.Since(entry.fetchedAt) > c.ttl {
+		return nil, false
+	}
+	return entry.block, true
+}
+
+func (c *blockCache) put(number int, block *FullBlockResult) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	now := time.Now()
+	for n, entry := range c.entries {
+		if now.Sub(entry.fetchedAt) > c.ttl {
+			delete(c.entries, n)
+		}
+	}
+	c.entries[number] = blockCacheEntry{block: block, fetchedAt: now}
+}
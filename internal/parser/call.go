@@ -0,0 +1,120 @@
+package parser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/dungnh3/trustwallet-assignment/rest"
+)
+
+// batchMethod names batch requests in metrics and traces.
+const batchMethod = "batch"
+
+// ErrMissingResponse is reported for the calls of a batch the node did not
+// answer, as some public endpoints drop calls under load. It wraps
+// ErrUnexpectedResponse.
+var ErrMissingResponse = fmt.Errorf("%w: missing batch response", ErrUnexpectedResponse)
+
+// BatchPartialFailurePolicy decides how BatchCall handles the calls of a
+// batch the node did not answer.
+type BatchPartialFailurePolicy int
+
+const (
+	// FillMissing reports ErrMissingResponse in the BatchElem.Error of each
+	// unanswered call, the other calls succeeding or failing on their own.
+	FillMissing BatchPartialFailurePolicy = iota
+	// FailOnMissing also fails the whole BatchCall with ErrMissingResponse.
+	FailOnMissing
+)
+
+// BatchElem is a call of a BatchCall. Error is set when the call failed.
+type BatchElem struct {
+	Method string
+	Params interface{}
+	// Result points to the value the result is decoded into, nil to
+	// discard it.
+	Result interface{}
+	Error  error
+}
+
+// Call invokes any JSON-RPC method, e.g. eth_call or debug_traceTransaction,
+// and decodes its result into the value pointed to by result, unless nil.
+// Error objects are returned as *RPCError wrapped in a *CallError.
+func (s *Invoker) Call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	if result == nil {
+		result = new(json.RawMessage)
+	}
+	// the decoder fills the value result points to rather than replacing it
+	out := RPCResponse[interface{}]{Result: result}
+	return send(ctx, s, method, params, &out)
+}
+
+// BatchCall sends the calls of batch in a single request, matching the
+// responses to the calls by id whatever their order. The returned error
+// reports the failure of the whole request, or unanswered calls under
+// FailOnMissing; each call reports its own in BatchElem.Error.
+func (s *Invoker) BatchCall(ctx context.Context, batch []BatchElem) (err error) {
+	if len(batch) == 0 {
+		return nil
+	}
+	defer observeRPC(batchMethod, time.Now(), &err)
+	defer func() {
+		s.stats.rpcDone(err)
+	}()
+
+	requests := make([]map[string]interface{}, len(batch))
+	elems := make(map[int]*BatchElem, len(batch))
+	failover := true
+	for i := range batch {
+		if nonIdempotentMethods[batch[i].Method] {
+			failover = false
+		}
+		id := s.nextID()
+		requests[i] = map[string]interface{}{
+			"jsonrpc": s.jsonrpc,
+			"method":  s.methodName(batch[i].Method),
+			"params":  batch[i].Params,
+			"id":      id,
+		}
+		elems[id] = &batch[i]
+	}
+
+	var successRaw rest.Raw
+	failureRaw, err := s.post(s.callContext(ctx, batchMethod, nil), &requests, &successRaw, failover)
+	if err != nil {
+		return &CallError{Method: batchMethod, Err: err}
+	}
+	if failureRaw != nil {
+		// nodes answer a batch they reject as a whole with a single error
+		return &CallError{Method: batchMethod, Err: responseError(failureRaw)}
+	}
+	var responses []RPCResponse[json.RawMessage]
+	if err := json.Unmarshal(successRaw, &responses); err != nil {
+		return &CallError{Method: batchMethod, Err: err}
+	}
+
+	for _, resp := range responses {
+		elem, ok := elems[resp.ID]
+		if !ok {
+			continue
+		}
+		delete(elems, resp.ID)
+		switch {
+		case resp.Error != nil:
+			elem.Error = &CallError{Method: elem.Method, Err: resp.Error}
+		case elem.Result != nil:
+			if err := json.Unmarshal(resp.Result, elem.Result); err != nil {
+				elem.Error = &CallError{Method: elem.Method, Err: err}
+			}
+		}
+	}
+	for id, elem := range elems {
+		elem.Error = &CallError{Method: elem.Method, Err: fmt.Errorf("%w: no response to id %d", ErrMissingResponse, id)}
+	}
+	if len(elems) > 0 && s.batchPolicy == FailOnMissing {
+		return &CallError{Method: batchMethod, Err: fmt.Errorf("%w: %d of %d calls", ErrMissingResponse, len(elems), len(batch))}
+	}
+	return nil
+}
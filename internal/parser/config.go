@@ -0,0 +1,261 @@
+package parser
+
+import (
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+type config struct {
+	// interval between two polls of a subscription
+	interval time.Duration
+	// bounds of the interval following the block time, zero when fixed
+	adaptiveMin, adaptiveMax time.Duration
+	// maximum number of blocks scanned by a backfill
+	maxBackfillBlocks int
+	// maximum number of blocks scanned by a poll, 0 for no limit
+	maxBlocksPerTick int
+	// maximum number of subscriptions scanning at once, 0 for no limit
+	maxConcurrentSubscriptions int
+	// JSON-RPC method names sent in place of the standard ones
+	methodOverrides map[string]string
+	// headers sent with every RPC request, e.g. provider API keys
+	headers map[string]string
+	// basic auth credentials sent with every RPC request
+	basicAuth *basicAuth
+	// capacity of each Watch channel
+	notificationBuffer int
+	// behavior of Watch channels when full
+	notificationPolicy NotificationPolicy
+	// otelhttp options of the traced RPC client, nil when not traced
+	tracing []otelhttp.Option
+	// age after which recorded transactions are deleted, 0 keeps them
+	retention time.Duration
+	// interval between two retention passes
+	retentionInterval time.Duration
+	// generates the id of each JSON-RPC request
+	idGenerator func() int
+	// handling of batch calls left unanswered
+	batchPolicy BatchPartialFailurePolicy
+	// whether notifications carry the receipt of their transaction
+	receipts bool
+	// weighted URLs receiving the calls in place of the host
+	endpoints []Endpoint
+}
+
+type basicAuth struct {
+	username string
+	password string
+}
+
+type Option interface {
+	apply(*config)
+}
+
+type optionFunc func(*config)
+
+func (o optionFunc) apply(c *config) {
+	o(c)
+}
+
+func newConfig(opts ...Option) *config {
+	c := &config{
+		interval:          5 * time.Second,
+		maxBackfillBlocks: 10000,
+		headers:           make(map[string]string),
+
+		notificationBuffer: 64,
+		notificationPolicy: DropOldest,
+
+		retentionInterval: time.Hour,
+		idGenerator:       counter(),
+	}
+	for _, opt := range opts {
+		opt.apply(c)
+	}
+
+	return c
+}
+
+func WithInterval(interval time.Duration) Option {
+	return optionFunc(func(c *config) {
+		if interval > 0 {
+			c.interval = interval
+		}
+	})
+}
+
+// WithAdaptivePolling makes the poll interval follow the block time of the
+// chain, as measured from the blocks seen by the polls, within
+// [minInterval, maxInterval]: slower chains are polled less often and faster
+// ones without lagging. The interval of WithInterval is used until the first
+// measure, and SetInterval only holds until the next one. minInterval is at
+// least MinInterval.
+func WithAdaptivePolling(minInterval, maxInterval time.Duration) Option {
+	return optionFunc(func(c *config) {
+		c.adaptiveMin = max(minInterval, MinInterval)
+		c.adaptiveMax = max(maxInterval, c.adaptiveMin)
+	})
+}
+
+// WithMaxBackfillBlocks bounds how many blocks SubscribeFromBlock scans
+// before live polling starts.
+func WithMaxBackfillBlocks(n int) Option {
+	return optionFunc(func(c *config) {
+		if n > 0 {
+			c.maxBackfillBlocks = n
+		}
+	})
+}
+
+// WithMaxBlocksPerTick bounds how many new blocks a poll scans, so that a
+// parser far behind the tip catches up over several intervals instead of
+// stalling on thousands of blocks at once. The remaining blocks are exposed
+// as the parser_block_backlog metric.
+func WithMaxBlocksPerTick(n int) Option {
+	return optionFunc(func(c *config) {
+		if n > 0 {
+			c.maxBlocksPerTick = n
+		}
+	})
+}
+
+// WithMaxConcurrentSubscriptions bounds how many subscriptions scan blocks at
+// once, so that subscribing thousands of addresses from past blocks does not
+// flood the node with their backfills. The others wait for their turn, or
+// give up when unsubscribed meanwhile. Blocks mined afterwards are polled by
+// a single loop whatever n.
+func WithMaxConcurrentSubscriptions(n int) Option {
+	return optionFunc(func(c *config) {
+		if n > 0 {
+			c.maxConcurrentSubscriptions = n
+		}
+	})
+}
+
+// WithMethodOverrides remaps standard JSON-RPC method names, e.g.
+// {"eth_blockNumber": "custom_blockNumber"}, for providers exposing
+// non-standard names. Methods absent from overrides keep their standard name.
+func WithMethodOverrides(overrides map[string]string) Option {
+	return optionFunc(func(c *config) {
+		c.methodOverrides = make(map[string]string, len(overrides))
+		for method, override := range overrides {
+			if override != "" {
+				c.methodOverrides[method] = override
+			}
+		}
+	})
+}
+
+// WithAuthHeader sends the header key with every RPC request, for providers
+// expecting the API key in a header rather than in the host URL.
+func WithAuthHeader(key, value string) Option {
+	return optionFunc(func(c *config) {
+		if key != "" {
+			c.headers[key] = value
+		}
+	})
+}
+
+// WithBasicAuth authenticates every RPC request with HTTP basic auth.
+func WithBasicAuth(username, password string) Option {
+	return optionFunc(func(c *config) {
+		c.basicAuth = &basicAuth{username: username, password: password}
+	})
+}
+
+// WithNotificationBuffer sets the capacity of the channels returned by Watch.
+func WithNotificationBuffer(n int) Option {
+	return optionFunc(func(c *config) {
+		if n >= 0 {
+			c.notificationBuffer = n
+		}
+	})
+}
+
+// WithNotificationPolicy sets what happens when a Watch channel is full.
+// DropOldest, the default, keeps a dead consumer from stalling block
+// processing; BlockUntilDelivered guarantees delivery at the cost of
+// delaying polls.
+func WithNotificationPolicy(policy NotificationPolicy) Option {
+	return optionFunc(func(c *config) {
+		c.notificationPolicy = policy
+	})
+}
+
+// WithBatchPartialFailurePolicy sets how BatchCall handles the calls the node
+// did not answer. FillMissing is the default.
+func WithBatchPartialFailurePolicy(policy BatchPartialFailurePolicy) Option {
+	return optionFunc(func(c *config) {
+		c.batchPolicy = policy
+	})
+}
+
+// WithReceipts attaches to each Notification the receipt of its transaction,
+// telling whether it succeeded. The receipts of a block are fetched with a
+// single eth_getBlockReceipts, or one eth_getTransactionReceipt per
+// transaction of the subscribed addresses on nodes lacking it.
+func WithReceipts() Option {
+	return optionFunc(func(c *config) {
+		c.receipts = true
+	})
+}
+
+// WithEndpoints sends the calls to endpoints instead of the host given to
+// New, each receiving a share of them proportional to its weight, e.g. most
+// to a paid provider and the rest to a free fallback. An endpoint that times
+// out or cannot be reached is skipped for a while whatever its weight, its
+// call failing over to the next endpoint unless sending it twice is not
+// idempotent, as for eth_sendRawTransaction.
+func WithEndpoints(endpoints []Endpoint) Option {
+	return optionFunc(func(c *config) {
+		c.endpoints = c.endpoints[:0]
+		for _, endpoint := range endpoints {
+			if endpoint.URL != "" {
+				c.endpoints = append(c.endpoints, endpoint)
+			}
+		}
+	})
+}
+
+// WithTracing traces every RPC request, naming the JSON-RPC method and block
+// in the span attributes rpc.method and eth.block.
+func WithTracing(opts ...otelhttp.Option) Option {
+	return optionFunc(func(c *config) {
+		c.tracing = append([]otelhttp.Option{}, opts...)
+	})
+}
+
+// WithRetention deletes the recorded transactions older than maxAge, checking
+// every interval, or every hour when interval is not positive. Transactions
+// are kept forever by default.
+func WithRetention(maxAge, interval time.Duration) Option {
+	return optionFunc(func(c *config) {
+		if maxAge > 0 {
+			c.retention = maxAge
+		}
+		if interval > 0 {
+			c.retentionInterval = interval
+		}
+	})
+}
+
+// WithIDGenerator generates the id of each JSON-RPC request with fn, which
+// must be safe for concurrent use. Responses carrying another id are
+// rejected. Ids count up from 1 by default.
+func WithIDGenerator(fn func() int) Option {
+	return optionFunc(func(c *config) {
+		if fn != nil {
+			c.idGenerator = fn
+		}
+	})
+}
+
+// counter returns a generator of increasing ids starting at 1.
+func counter() func() int {
+	var id atomic.Int64
+	return func() int {
+		return int(id.Add(1))
+	}
+}
@@ -0,0 +1,34 @@
+package parser
+
+import "github.com/dungnh3/trustwallet-assignment/internal/utils"
+
+// Direction classifies a transaction relative to an address.
+type Direction string
+
+const (
+	// Incoming transactions are sent to the address.
+	Incoming Direction = "in"
+	// Outgoing transactions are sent from the address.
+	Outgoing Direction = "out"
+	// Self transactions are sent from the address to itself.
+	Self Direction = "self"
+	// Unrelated transactions neither come from nor go to the address.
+	Unrelated Direction = "unrelated"
+)
+
+// Direction returns the direction of t relative to address, ignoring case.
+func (t Transaction) Direction(address string) Direction {
+	address = utils.NormalizeAddress(address)
+	from := utils.NormalizeAddress(t.From) == address
+	to := utils.NormalizeAddress(t.To) == address
+	switch {
+	case from && to:
+		return Self
+	case from:
+		return Outgoing
+	case to:
+		return Incoming
+	default:
+		return Unrelated
+	}
+}
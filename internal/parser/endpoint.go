@@ -0,0 +1,114 @@
+package parser
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dungnh3/trustwallet-assignment/rest"
+)
+
+// endpointCooldown is how long an endpoint that failed to answer is skipped.
+const endpointCooldown = 30 * time.Second
+
+// nonIdempotentMethods are the methods never sent twice, e.g. on failover,
+// since the node may have processed a call it failed to answer.
+var nonIdempotentMethods = map[string]bool{
+	"eth_sendRawTransaction": true,
+	"eth_sendTransaction":    true,
+}
+
+// Endpoint is a URL of the node, see WithEndpoints.
+type Endpoint struct {
+	URL string
+	// Weight is the share of the calls sent to the endpoint relative to the
+	// others, 1 when not positive.
+	Weight int
+}
+
+// endpointPool picks the endpoint of each call by smooth weighted
+// round-robin, which spreads the calls of each endpoint evenly instead of
+// sending them in bursts. Endpoints that failed to answer are skipped until
+// endpointCooldown elapses, whatever their weight, unless all of them did.
+type endpointPool struct {
+	mutex     sync.Mutex
+	endpoints []*endpointState
+}
+
+type endpointState struct {
+	url    string
+	weight int
+	// current is the smooth weighted round-robin counter
+	current int
+	// downUntil is when a failed endpoint is tried again, zero when healthy
+	downUntil time.Time
+}
+
+func newEndpointPool(endpoints []Endpoint) *endpointPool {
+	p := &endpointPool{}
+	for _, endpoint := range endpoints {
+		p.endpoints = append(p.endpoints, &endpointState{url: endpoint.URL, weight: max(endpoint.Weight, 1)})
+	}
+	return p
+}
+
+// next returns the endpoint of the next call.
+func (p *endpointPool) next() *endpointState {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	now := time.Now()
+	candidates := make([]*endpointState, 0, len(p.endpoints))
+	for _, e := range p.endpoints {
+		if !now.Before(e.downUntil) {
+			candidates = append(candidates, e)
+		}
+	}
+	if len(candidates) == 0 {
+		// every endpoint is down, try them all rather than none
+		candidates = p.endpoints
+	}
+
+	var best *endpointState
+	total := 0
+	for _, e := range candidates {
+		e.current += e.weight
+		total += e.weight
+		if best == nil || e.current > best.current {
+			best = e
+		}
+	}
+	best.current -= total
+	return best
+}
+
+// report marks e down when err is a failure to get an answer from it, and
+// healthy otherwise.
+func (p *endpointPool) report(e *endpointState, err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if err != nil && failureCause(err) != "" {
+		e.downUntil = time.Now().Add(endpointCooldown)
+		return
+	}
+	e.downUntil = time.Time{}
+}
+
+// post posts body to the next endpoint, failing over to the following ones
+// while endpoints time out or cannot be reached unless !failover, and
+// returns the failure body of an error response.
+func (s *Invoker) post(ctx context.Context, body interface{}, successV *rest.Raw, failover bool) (rest.Raw, error) {
+	var err error
+	for range s.endpoints.endpoints {
+		endpoint := s.endpoints.next()
+		var failureRaw rest.Raw
+		// s.cli is shared by every subscription, so each call builds its
+		// request on a clone.
+		_, failureRaw, err = s.cli.Clone().Base(endpoint.url).Post("").
+			BodyJSON(body).ReceiveRawOnErrorContext(ctx, successV)
+		s.endpoints.report(endpoint, err)
+		if err == nil || !failover || failureCause(err) == "" || ctx.Err() != nil {
+			return failureRaw, err
+		}
+	}
+	return nil, err
+}
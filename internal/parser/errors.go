@@ -0,0 +1,102 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dungnh3/trustwallet-assignment/rest"
+)
+
+// ErrUnexpectedResponse is returned when the node answers with a non-success
+// response.
+var ErrUnexpectedResponse = errors.New("unexpected response")
+
+var (
+	// ErrInvalidAddress is returned before any RPC call when an address is
+	// not a 0x-prefixed 20-byte hex string.
+	ErrInvalidAddress = errors.New("invalid address")
+	// ErrInvalidBlockTag is returned before any RPC call when a block tag is
+	// neither a hex number nor a known tag.
+	ErrInvalidBlockTag = errors.New("invalid block tag")
+	// ErrInvalidQuery is returned for transaction and log queries with
+	// options out of range or contradicting each other.
+	ErrInvalidQuery = errors.New("invalid query")
+	// ErrBlockNotFound is returned when the node answers a block lookup with
+	// a null result.
+	ErrBlockNotFound = errors.New("block not found")
+	// ErrTransactionNotFound is returned when the node answers a transaction
+	// lookup with a null result.
+	ErrTransactionNotFound = errors.New("transaction not found")
+	// ErrMethodNotSupported is returned when the node does not implement a
+	// method other nodes do, e.g. eth_getBlockReceipts, for callers to fall
+	// back to another one.
+	ErrMethodNotSupported = errors.New("method not supported")
+)
+
+// CallError reports which JSON-RPC call failed and why.
+type CallError struct {
+	Method string
+	Err    error
+}
+
+func (e *CallError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Method, e.Err)
+}
+
+func (e *CallError) Unwrap() error {
+	return e.Err
+}
+
+// RPCError is the error object of a JSON-RPC response. It wraps
+// ErrUnexpectedResponse.
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("%v: %d %s", ErrUnexpectedResponse, e.Code, e.Message)
+}
+
+func (e *RPCError) Unwrap() error {
+	return ErrUnexpectedResponse
+}
+
+// responseError returns the error object of a JSON-RPC response, or
+// ErrUnexpectedResponse with the raw body when it has none.
+func responseError(body []byte) error {
+	var envelope RPCResponse[json.RawMessage]
+	if err := json.Unmarshal(body, &envelope); err != nil || envelope.Error == nil {
+		return fmt.Errorf("%w: %s", ErrUnexpectedResponse, body)
+	}
+	return envelope.Error
+}
+
+// methodNotSupported returns err wrapping ErrMethodNotSupported when the node
+// answered that it does not know the method called.
+func methodNotSupported(err error) error {
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) {
+		return err
+	}
+	if rpcErr.Code == -32601 || strings.Contains(strings.ToLower(rpcErr.Message), "not supported") {
+		return fmt.Errorf("%w: %w", ErrMethodNotSupported, err)
+	}
+	return err
+}
+
+// failureCause tells, for logs, whether err is the node timing out or being
+// unreachable; it is empty for other errors.
+func failureCause(err error) string {
+	switch {
+	case rest.IsTimeout(err):
+		return "timeout"
+	case rest.IsConnError(err):
+		return "unreachable"
+	default:
+		return ""
+	}
+}
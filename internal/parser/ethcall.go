@@ -0,0 +1,167 @@
+package parser
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/dungnh3/trustwallet-assignment/internal/utils"
+)
+
+// errorSelector prefixes the revert data of require(cond, "reason") and
+// revert("reason"), the selector of Error(string).
+const errorSelector = "0x08c379a0"
+
+// RevertError is returned by EthCall and EstimateGas when the called
+// contract reverts.
+type RevertError struct {
+	// Data is the hex revert data, empty when the node does not return it.
+	Data string
+	// Reason is the decoded reason of an Error(string) revert.
+	Reason string
+	Err    *RPCError
+}
+
+func (e *RevertError) Error() string {
+	if e.Reason != "" {
+		return "execution reverted: " + e.Reason
+	}
+	return "execution reverted"
+}
+
+func (e *RevertError) Unwrap() error {
+	return e.Err
+}
+
+// EthCall executes a read-only call of the contract at to with the ABI
+// encoded data, against the state at blockTag, and returns the hex encoded
+// return data, e.g. for DecodeUint256 or DecodeString. A reverted call
+// fails with a *RevertError.
+func (s *Invoker) EthCall(to string, data string, blockTag BlockTag) (string, error) {
+	if !utils.IsHexAddress(to) {
+		return "", fmt.Errorf("%q: %w", to, ErrInvalidAddress)
+	}
+	if err := blockTag.Validate(); err != nil {
+		return "", err
+	}
+	var result string
+	err := s.Call(s.ctx, "eth_call", []interface{}{map[string]string{"to": to, "data": data}, blockTag}, &result)
+	if err != nil {
+		return "", revertOf("eth_call", err)
+	}
+	return result, nil
+}
+
+// CallParams is the transaction simulated by EstimateGas. Nil and empty
+// fields are left for the node to fill in.
+type CallParams struct {
+	From     string
+	To       string
+	Value    *big.Int
+	Data     string
+	Gas      *big.Int
+	GasPrice *big.Int
+}
+
+func (p CallParams) args() map[string]string {
+	args := make(map[string]string)
+	for key, value := range map[string]string{"from": p.From, "to": p.To, "data": p.Data} {
+		if value != "" {
+			args[key] = value
+		}
+	}
+	for key, value := range map[string]*big.Int{"value": p.Value, "gas": p.Gas, "gasPrice": p.GasPrice} {
+		if value != nil {
+			args[key] = fmt.Sprintf("%#x", value)
+		}
+	}
+	return args
+}
+
+// EstimateGas returns the gas the node expects tx to use. A transaction
+// that would revert fails with a *RevertError.
+func (s *Invoker) EstimateGas(tx CallParams) (*big.Int, error) {
+	var result string
+	if err := s.Call(s.ctx, "eth_estimateGas", []interface{}{tx.args()}, &result); err != nil {
+		return nil, revertOf("eth_estimateGas", err)
+	}
+	gas, err := utils.ParseHexBig(result)
+	if err != nil {
+		return nil, &CallError{Method: "eth_estimateGas", Err: fmt.Errorf("%w: %v", ErrUnexpectedResponse, err)}
+	}
+	return gas, nil
+}
+
+// revertOf turns the error object of a reverted call of method into a
+// *RevertError, returning other errors unchanged.
+func revertOf(method string, err error) error {
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) && isRevert(rpcErr) {
+		return &CallError{Method: method, Err: newRevertError(rpcErr)}
+	}
+	return err
+}
+
+// isRevert reports whether e is the error of a reverted call: code 3 with
+// the revert data in geth, an "execution reverted" message elsewhere.
+func isRevert(e *RPCError) bool {
+	return e.Code == 3 || strings.Contains(e.Message, "execution reverted")
+}
+
+func newRevertError(e *RPCError) *RevertError {
+	revert := &RevertError{Err: e}
+	json.Unmarshal(e.Data, &revert.Data)
+	if encoded, ok := strings.CutPrefix(revert.Data, errorSelector); ok {
+		revert.Reason, _ = DecodeString("0x" + encoded)
+	}
+	if revert.Reason == "" {
+		// nodes without revert data may still name the reason
+		_, revert.Reason, _ = strings.Cut(e.Message, "execution reverted: ")
+	}
+	return revert
+}
+
+// DecodeUint256 decodes the hex return data of a function returning a
+// single uint256, e.g. balanceOf or decimals.
+func DecodeUint256(data string) (*big.Int, error) {
+	b, err := decodeHex(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != 32 {
+		return nil, fmt.Errorf("uint256: expected 32 bytes, got %d", len(b))
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// DecodeString decodes the hex return data of a function returning a single
+// string, e.g. symbol or name.
+func DecodeString(data string) (string, error) {
+	b, err := decodeHex(data)
+	if err != nil {
+		return "", err
+	}
+	if len(b) < 64 {
+		return "", fmt.Errorf("string: expected at least 64 bytes, got %d", len(b))
+	}
+	offset := new(big.Int).SetBytes(b[:32])
+	if !offset.IsInt64() || offset.Int64() > int64(len(b)-32) {
+		return "", fmt.Errorf("string: offset %s out of range", offset)
+	}
+	start := int(offset.Int64())
+	length := new(big.Int).SetBytes(b[start : start+32])
+	if !length.IsInt64() || length.Int64() > int64(len(b)-start-32) {
+		return "", fmt.Errorf("string: length %s out of range", length)
+	}
+	return string(b[start+32 : start+32+int(length.Int64())]), nil
+}
+
+func decodeHex(data string) ([]byte, error) {
+	if !strings.HasPrefix(data, "0x") && !strings.HasPrefix(data, "0X") {
+		return nil, fmt.Errorf("%q is not 0x-prefixed", data)
+	}
+	return hex.DecodeString(data[2:])
+}
@@ -0,0 +1,119 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dungnh3/trustwallet-assignment/internal/models"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// fetchConcurrency is the number of calls or batches an operation sends
+	// at once, see forEachChunk.
+	fetchConcurrency = 4
+	// blockBatchSize is the number of blocks fetched by each batch of a scan.
+	blockBatchSize = 32
+	// transactionBatchSize is the number of transactions fetched by each
+	// batch of fetchTransactions.
+	transactionBatchSize = 100
+)
+
+// forEachChunk splits [0, n) in chunks of size items and calls fn on each
+// chunk [lo, hi), fetchConcurrency of them at once. It returns the first
+// error, the context of the other calls being cancelled then.
+func forEachChunk(ctx context.Context, n, size int, fn func(ctx context.Context, lo, hi int) error) error {
+	group, ctx := errgroup.WithContext(ctx)
+	group.SetLimit(fetchConcurrency)
+	for lo := 0; lo < n; lo += size {
+		hi := min(lo+size, n)
+		group.Go(func() error {
+			return fn(ctx, lo, hi)
+		})
+	}
+	return group.Wait()
+}
+
+// getBlocks returns the blocks from and up to to with their full
+// transactions, fetched in batches of blockBatchSize, or ErrBlockNotFound
+// when one is not mined yet. Like GetBlockByNumber it shares the blocks of
+// the current poll cycle.
+func (s *Invoker) getBlocks(ctx context.Context, from, to int) ([]*FullBlockResult, error) {
+	if from > to {
+		return nil, nil
+	}
+	blocks := make([]*FullBlockResult, to-from+1)
+	err := forEachChunk(ctx, len(blocks), blockBatchSize, func(ctx context.Context, lo, hi int) error {
+		batch := make([]BatchElem, 0, hi-lo)
+		fetched := make([]int, 0, hi-lo)
+		for i := lo; i < hi; i++ {
+			if block, ok := s.cache.get(from + i); ok {
+				blocks[i] = block
+				continue
+			}
+			blocks[i] = &FullBlockResult{}
+			batch = append(batch, BatchElem{
+				Method: "eth_getBlockByNumber",
+				Params: []interface{}{BlockNumberTag(from + i), true},
+				Result: &blocks[i].Result,
+			})
+			fetched = append(fetched, i)
+		}
+		if err := s.BatchCall(ctx, batch); err != nil {
+			return err
+		}
+		for j, i := range fetched {
+			if err := batch[j].Error; err != nil {
+				return err
+			}
+			if blocks[i].Result == nil {
+				return fmt.Errorf("block %s: %w", BlockNumberTag(from+i), ErrBlockNotFound)
+			}
+			s.cache.put(from+i, blocks[i])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+// fetchTransactions fetches the recorded transactions from the node, in
+// batches of transactionBatchSize.
+func (s *Invoker) fetchTransactions(ctx context.Context, blockTransactions []*models.BlockTransaction) ([]Transaction, error) {
+	if len(blockTransactions) == 0 {
+		return nil, nil
+	}
+	results := make([]*Transaction, len(blockTransactions))
+	err := forEachChunk(ctx, len(results), transactionBatchSize, func(ctx context.Context, lo, hi int) error {
+		batch := make([]BatchElem, hi-lo)
+		for i := range batch {
+			batch[i] = BatchElem{
+				Method: "eth_getTransactionByHash",
+				Params: []string{blockTransactions[lo+i].TransactionAddress},
+				Result: &results[lo+i],
+			}
+		}
+		if err := s.BatchCall(ctx, batch); err != nil {
+			return err
+		}
+		for _, elem := range batch {
+			if elem.Error != nil {
+				return elem.Error
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	transactions := make([]Transaction, 0, len(results))
+	for i, trans := range results {
+		if trans == nil {
+			return nil, fmt.Errorf("%s: %w", blockTransactions[i].TransactionAddress, ErrTransactionNotFound)
+		}
+		transactions = append(transactions, *trans)
+	}
+	return transactions, nil
+}
@@ -0,0 +1,127 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// LogFilter selects the logs of eth_getLogs.
+type LogFilter struct {
+	FromBlock int
+	ToBlock   int
+	// Addresses are the contracts emitting the logs, any when empty.
+	Addresses []string
+	// Topics filters the topics by position, a log matching when its topic
+	// is one of those of the position. An empty position matches any topic.
+	Topics [][]string
+}
+
+// params returns f as the filter object of eth_getLogs.
+func (f LogFilter) params() map[string]interface{} {
+	params := map[string]interface{}{
+		"fromBlock": BlockNumberTag(f.FromBlock),
+		"toBlock":   BlockNumberTag(f.ToBlock),
+	}
+	if len(f.Addresses) > 0 {
+		params["address"] = f.Addresses
+	}
+	if len(f.Topics) > 0 {
+		topics := make([]interface{}, len(f.Topics))
+		for i, position := range f.Topics {
+			if len(position) > 0 {
+				topics[i] = position
+			}
+		}
+		params["topics"] = topics
+	}
+	return params
+}
+
+// GetLogs returns the logs matching filter with a single eth_getLogs, which
+// nodes reject over wide block ranges; see GetLogsChunked.
+func (s *Invoker) GetLogs(filter LogFilter) ([]Log, error) {
+	return s.getLogs(s.ctx, filter)
+}
+
+func (s *Invoker) getLogs(ctx context.Context, filter LogFilter) ([]Log, error) {
+	if filter.FromBlock < 0 || filter.FromBlock > filter.ToBlock {
+		return nil, fmt.Errorf("%w: block range %d to %d", ErrInvalidQuery, filter.FromBlock, filter.ToBlock)
+	}
+	var logs []Log
+	if err := s.Call(ctx, "eth_getLogs", []interface{}{filter.params()}, &logs); err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+// GetLogsChunked returns the logs matching filter, fetching its block range
+// in chunks of chunkSize blocks, fetchConcurrency at once, in block order. A
+// chunk the node refuses for returning too many results is split in halves
+// until it does not, down to a single block. The whole range is a single
+// chunk when chunkSize is not positive.
+func (s *Invoker) GetLogsChunked(filter LogFilter, chunkSize int) ([]Log, error) {
+	if filter.FromBlock < 0 || filter.FromBlock > filter.ToBlock {
+		return nil, fmt.Errorf("%w: block range %d to %d", ErrInvalidQuery, filter.FromBlock, filter.ToBlock)
+	}
+	if chunkSize <= 0 {
+		chunkSize = filter.ToBlock - filter.FromBlock + 1
+	}
+
+	blocks := filter.ToBlock - filter.FromBlock + 1
+	chunks := make([][]Log, (blocks+chunkSize-1)/chunkSize)
+	err := forEachChunk(s.ctx, blocks, chunkSize, func(ctx context.Context, lo, hi int) error {
+		chunk := filter
+		chunk.FromBlock, chunk.ToBlock = filter.FromBlock+lo, filter.FromBlock+hi-1
+		logs, err := s.getLogsHalving(ctx, chunk)
+		chunks[lo/chunkSize] = logs
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	var logs []Log
+	for _, chunk := range chunks {
+		logs = append(logs, chunk...)
+	}
+	return logs, nil
+}
+
+// getLogsHalving is getLogs splitting the block range of filter in halves
+// while the node answers with too many results.
+func (s *Invoker) getLogsHalving(ctx context.Context, filter LogFilter) ([]Log, error) {
+	logs, err := s.getLogs(ctx, filter)
+	if err == nil || !tooManyResults(err) || filter.FromBlock == filter.ToBlock {
+		return logs, err
+	}
+	mid := filter.FromBlock + (filter.ToBlock-filter.FromBlock)/2
+	first, second := filter, filter
+	first.ToBlock, second.FromBlock = mid, mid+1
+	if logs, err = s.getLogsHalving(ctx, first); err != nil {
+		return nil, err
+	}
+	more, err := s.getLogsHalving(ctx, second)
+	if err != nil {
+		return nil, err
+	}
+	return append(logs, more...), nil
+}
+
+// tooManyResults reports whether err is the node refusing an eth_getLogs
+// query for its results or block range being too large. Providers word it
+// differently, e.g. "query returned more than 10000 results" or "block range
+// is too large".
+func tooManyResults(err error) bool {
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) {
+		return false
+	}
+	message := strings.ToLower(rpcErr.Message)
+	for _, hint := range []string{"more than", "too many", "too large", "range exceeds"} {
+		if strings.Contains(message, hint) {
+			return true
+		}
+	}
+	return false
+}
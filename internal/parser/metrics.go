@@ -0,0 +1,55 @@
+package parser
+
+import (
+	"time"
+
+	"github.com/dungnh3/trustwallet-assignment/rest"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// restCounterVec is shared by every Invoker so it can be registered once.
+	restCounterVec = rest.NapCounterVec()
+	// restInFlightVec is shared by every Invoker like restCounterVec.
+	restInFlightVec = rest.NapInFlightVec()
+
+	rpcDurationVec = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "parser_rpc_duration_seconds",
+		Help:    "Duration of JSON-RPC calls issued by the parser.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "outcome"})
+
+	backfillBlocksCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "parser_backfill_blocks_total",
+		Help: "Blocks scanned by subscription backfills.",
+	})
+
+	blockBacklogGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "parser_block_backlog",
+		Help: "Blocks left to scan after the last poll, for the address furthest behind.",
+	})
+
+	subscriptionScansGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "parser_subscription_scans_in_flight",
+		Help: "Subscription backfills scanning blocks, see WithMaxConcurrentSubscriptions.",
+	})
+
+	notificationsDroppedCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "parser_notifications_dropped_total",
+		Help: "Notifications dropped because a watcher was not keeping up.",
+	})
+)
+
+// Collectors returns the metrics of the parser and its rest client. They must
+// be registered once, e.g. prometheus.MustRegister(parser.Collectors()...).
+func Collectors() []prometheus.Collector {
+	return []prometheus.Collector{restCounterVec, restInFlightVec, rpcDurationVec, backfillBlocksCounter, blockBacklogGauge, subscriptionScansGauge, notificationsDroppedCounter}
+}
+
+func observeRPC(method string, start time.Time, err *error) {
+	outcome := "success"
+	if *err != nil {
+		outcome = "error"
+	}
+	rpcDurationVec.WithLabelValues(method, outcome).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,136 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/dungnh3/trustwallet-assignment/internal/utils"
+)
+
+// GetNonce returns the number of transactions sent from address as of
+// blockTag, which is the nonce of its next transaction for Pending.
+func (s *Invoker) GetNonce(address string, blockTag BlockTag) (uint64, error) {
+	if !utils.IsHexAddress(address) {
+		return 0, fmt.Errorf("%q: %w", address, ErrInvalidAddress)
+	}
+	if err := blockTag.Validate(); err != nil {
+		return 0, err
+	}
+	var result string
+	if err := s.Call(s.ctx, "eth_getTransactionCount", []interface{}{address, blockTag}, &result); err != nil {
+		return 0, err
+	}
+	if !utils.IsHex(result) {
+		return 0, fmt.Errorf("nonce of %s: %w: %s", address, ErrUnexpectedResponse, result)
+	}
+	nonce, err := strconv.ParseUint(result[2:], 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("nonce of %s: %w: %s", address, ErrUnexpectedResponse, result)
+	}
+	return nonce, nil
+}
+
+// NonceManager hands out the nonces of the transactions sent from each
+// address, counting them locally once seeded from the pending nonce, so that
+// sequential sends do not race the node into "nonce too low" rejections.
+// Sends from one address are serialized, sends from different addresses are
+// not.
+type NonceManager struct {
+	parser Parser
+
+	mutex    sync.Mutex
+	accounts map[string]*accountNonce
+}
+
+// accountNonce is the next nonce of an address, unknown until seeded.
+type accountNonce struct {
+	mutex sync.Mutex
+	next  uint64
+	known bool
+}
+
+func NewNonceManager(p Parser) *NonceManager {
+	return &NonceManager{
+		parser:   p,
+		accounts: make(map[string]*accountNonce),
+	}
+}
+
+// NextNonce reserves and returns the next nonce of address. A reserved nonce
+// that ends up unused leaves a gap; call Reset to fill it.
+func (m *NonceManager) NextNonce(address string) (uint64, error) {
+	account, err := m.lock(address)
+	if err != nil {
+		return 0, err
+	}
+	defer account.mutex.Unlock()
+	nonce := account.next
+	account.next++
+	return nonce, nil
+}
+
+// SendTransaction signs the transaction of address with its next nonce
+// through sign, then sends it. The nonce is only consumed when the node
+// accepts the transaction; on any failure, a rejection as too low included,
+// the nonce of address is reset.
+func (m *NonceManager) SendTransaction(address string, sign func(nonce uint64) (string, error)) (string, error) {
+	account, err := m.lock(address)
+	if err != nil {
+		return "", err
+	}
+	defer account.mutex.Unlock()
+	signedTxHex, err := sign(account.next)
+	if err != nil {
+		return "", err
+	}
+	hash, err := m.parser.SendRawTransaction(signedTxHex)
+	if err != nil {
+		// the nonce was changed by someone else, or the transaction may
+		// have been accepted anyway
+		account.known = false
+		return "", err
+	}
+	account.next++
+	return hash, nil
+}
+
+// Reset forgets the nonce of address, to be seeded again from the node on
+// next use, e.g. after transactions were sent from it elsewhere.
+func (m *NonceManager) Reset(address string) {
+	m.mutex.Lock()
+	account, ok := m.accounts[utils.NormalizeAddress(address)]
+	m.mutex.Unlock()
+	if !ok {
+		return
+	}
+	account.mutex.Lock()
+	defer account.mutex.Unlock()
+	account.known = false
+}
+
+// lock returns the seeded nonce of address, locked.
+func (m *NonceManager) lock(address string) (*accountNonce, error) {
+	if !utils.IsHexAddress(address) {
+		return nil, fmt.Errorf("%q: %w", address, ErrInvalidAddress)
+	}
+	address = utils.NormalizeAddress(address)
+	m.mutex.Lock()
+	account, ok := m.accounts[address]
+	if !ok {
+		account = &accountNonce{}
+		m.accounts[address] = account
+	}
+	m.mutex.Unlock()
+
+	account.mutex.Lock()
+	if !account.known {
+		next, err := m.parser.GetNonce(address, Pending)
+		if err != nil {
+			account.mutex.Unlock()
+			return nil, err
+		}
+		account.next, account.known = next, true
+	}
+	return account, nil
+}
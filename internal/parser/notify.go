@@ -0,0 +1,120 @@
+package parser
+
+import (
+	"context"
+	"sync"
+)
+
+// NotificationPolicy decides what happens to a notification published while
+// a watcher channel is full.
+type NotificationPolicy int
+
+const (
+	// DropOldest discards the oldest buffered notification to make room.
+	DropOldest NotificationPolicy = iota
+	// DropNewest discards the notification being published.
+	DropNewest
+	// BlockUntilDelivered waits for the watcher to make room, stalling the
+	// poll loop of the address until it does or releases its channel.
+	BlockUntilDelivered
+)
+
+// Notification is emitted for every new transaction recorded for a
+// subscribed address.
+type Notification struct {
+	Address     string      `json:"address"`
+	Transaction Transaction `json:"transaction"`
+	// Receipt is the receipt of Transaction, nil unless WithReceipts.
+	Receipt *Receipt `json:"receipt,omitempty"`
+}
+
+type watcher struct {
+	ch chan Notification
+	// done is closed on release, before ch is, to abort blocked publishes.
+	done chan struct{}
+}
+
+// broadcaster fans notifications out to the watchers of an address.
+type broadcaster struct {
+	buffer int
+	policy NotificationPolicy
+
+	mutex    sync.RWMutex
+	nextID   int
+	watchers map[string]map[int]*watcher
+}
+
+func newBroadcaster(buffer int, policy NotificationPolicy) *broadcaster {
+	return &broadcaster{
+		buffer:   buffer,
+		policy:   policy,
+		watchers: make(map[string]map[int]*watcher),
+	}
+}
+
+func (b *broadcaster) watch(address string) (<-chan Notification, func()) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	id := b.nextID
+	b.nextID++
+	w := &watcher{
+		ch:   make(chan Notification, b.buffer),
+		done: make(chan struct{}),
+	}
+	if b.watchers[address] == nil {
+		b.watchers[address] = make(map[int]*watcher)
+	}
+	b.watchers[address][id] = w
+
+	var once sync.Once
+	return w.ch, func() {
+		once.Do(func() {
+			close(w.done)
+			b.mutex.Lock()
+			defer b.mutex.Unlock()
+			delete(b.watchers[address], id)
+			if len(b.watchers[address]) == 0 {
+				delete(b.watchers, address)
+			}
+			close(w.ch)
+		})
+	}
+}
+
+// publish delivers n to every watcher of n.Address, applying the policy to
+// watchers that are not keeping up. Blocking publishes end with ctx.
+func (b *broadcaster) publish(ctx context.Context, n Notification) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	for _, w := range b.watchers[n.Address] {
+		select {
+		case w.ch <- n:
+			continue
+		default:
+		}
+
+		switch b.policy {
+		case DropNewest:
+			notificationsDroppedCounter.Inc()
+		case DropOldest:
+			select {
+			case <-w.ch:
+				notificationsDroppedCounter.Inc()
+			default:
+			}
+			select {
+			case w.ch <- n:
+			default:
+				notificationsDroppedCounter.Inc()
+			}
+		case BlockUntilDelivered:
+			select {
+			case w.ch <- n:
+			case <-w.done:
+			case <-ctx.Done():
+				notificationsDroppedCounter.Inc()
+			}
+		}
+	}
+}
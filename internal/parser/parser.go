@@ -2,230 +2,411 @@ package parser
 
 import (
 	"context"
-	"errors"
+	"encoding/json"
 	"fmt"
 	"github.com/dungnh3/trustwallet-assignment/internal/models"
 	"github.com/dungnh3/trustwallet-assignment/internal/repositories"
 	"github.com/dungnh3/trustwallet-assignment/internal/utils"
 	"github.com/dungnh3/trustwallet-assignment/rest"
-	"github.com/google/uuid"
 	"go.uber.org/zap"
+	"golang.org/x/sync/semaphore"
+	"math/big"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Parser interface {
 	GetCurrentBlock() int
+	CurrentBlock() (int, error)
+	CurrentBlockContext(ctx context.Context) (int, error)
+	Ping(ctx context.Context) error
+	ChainID(ctx context.Context) (int, error)
+	SetInterval(d time.Duration)
 	Subscribe(address string) bool
+	SubscribeE(ctx context.Context, address string) (<-chan error, error)
+	SubscribeFromBlock(address string, fromBlock int) bool
+	SubscribeWhen(address string, predicate func(info *models.BlockInfo) bool, fn func()) bool
+	Unsubscribe(address string) bool
 	GetTransactions(address string) []Transaction
+	Transactions(address string) ([]Transaction, error)
+	TransactionsContext(ctx context.Context, address string) ([]Transaction, error)
+	Call(ctx context.Context, method string, params interface{}, result interface{}) error
+	BatchCall(ctx context.Context, batch []BatchElem) error
+	EthCall(to string, data string, blockTag BlockTag) (string, error)
+	TokenInfo(contract string) (TokenInfo, error)
+	EstimateGas(tx CallParams) (*big.Int, error)
+	SendRawTransaction(signedTxHex string) (string, error)
+	GetNonce(address string, blockTag BlockTag) (uint64, error)
+	GetTransactionReceipt(hash string) (*Receipt, error)
+	GetBlockReceipts(blockTag BlockTag) ([]Receipt, error)
+	BlockTransactionCount(blockTag BlockTag) (int, error)
+	GetLogs(filter LogFilter) ([]Log, error)
+	GetLogsChunked(filter LogFilter, chunkSize int) ([]Log, error)
+	GetTransactionsFiltered(address string, q TransactionQuery) (*TransactionPage, error)
+	GetTransactionsFilteredContext(ctx context.Context, address string, q TransactionQuery) (*TransactionPage, error)
+	Watch(address string) (<-chan Notification, func())
+	Status() ParserStatus
+	Close() error
 }
 
 type Invoker struct {
-	ctx      context.Context
-	host     string
-	jsonrpc  string
-	cli      *rest.Rest
-	logger   *zap.Logger
-	repo     repositories.Repository
-	interval time.Duration
+	ctx     context.Context
+	host    string
+	jsonrpc string
+	cli     *rest.Rest
+	// endpoints receiving the calls, host unless WithEndpoints
+	endpoints *endpointPool
+	logger    *zap.Logger
+	repo      repositories.Repository
+
+	// interval between two polls, in nanoseconds; see SetInterval
+	interval atomic.Int64
+	// adaptive follows the block time, nil unless WithAdaptivePolling
+	adaptive *adaptiveInterval
+
+	maxBackfillBlocks int
+	maxBlocksPerTick  int
+	// scans bounds the concurrent backfills, nil for no limit
+	scans           *semaphore.Weighted
+	methodOverrides map[string]string
+	nextID          func() int
+	batchPolicy     BatchPartialFailurePolicy
+	withReceipts    bool
+	// noBlockReceipts is set once the node turned out to lack
+	// eth_getBlockReceipts
+	noBlockReceipts atomic.Bool
+
+	mutex         sync.Mutex
+	subscriptions map[string]*subscription
+	wg            sync.WaitGroup
+	// stopPoll stops the poll loop, nil when not running
+	stopPoll context.CancelFunc
+	// wake triggers a poll before the interval elapses
+	wake        chan struct{}
+	broadcaster *broadcaster
+	// stopRetention stops the retention goroutine, nil when not running
+	stopRetention context.CancelFunc
+
+	// lastBlocks caches, per address, the highest block fully processed
+	// and persisted as models.BlockInfo.LastProcessedBlock.
+	lastBlocksMutex sync.Mutex
+	lastBlocks      map[string]int
+
+	// triggers holds the armed SubscribeWhen callbacks, by address.
+	triggersMutex sync.Mutex
+	triggers      map[string]*trigger
+
+	stats  stats
+	cache  *blockCache
+	tokens tokenCache
 }
 
-func New(ctx context.Context, host string, repo repositories.Repository) Parser {
-	cli := rest.New().Base(host)
+func New(ctx context.Context, host string, repo repositories.Repository, opts ...Option) Parser {
+	c := newConfig(opts...)
+	restOpts := []rest.Option{
+		// many calls to a single host, keep the connections alive
+		rest.WithHttpClient(rest.DefaultPooledClient()),
+		rest.WithSuccessDecider(rest.JSONRPCSuccessDecider),
+		rest.WithSpanAttributes(rpcSpanAttributes),
+		rest.WithBaseHeaders(map[string]string{"Content-Type": "application/json"}),
+		rest.WithBaseHeaders(c.headers),
+	}
+	if c.tracing != nil {
+		restOpts = append(restOpts, rest.WithOtel(c.tracing...))
+	}
+	cli := rest.New(restOpts...).Base(host)
+	cli.CreatePrometheusVec(restCounterVec)
+	cli.CreatePrometheusGauge(restInFlightVec)
+	if c.basicAuth != nil {
+		cli.SetBasicAuth(c.basicAuth.username, c.basicAuth.password)
+	}
+	endpoints := c.endpoints
+	if len(endpoints) == 0 {
+		endpoints = []Endpoint{{URL: host}}
+	}
 	logger, _ := zap.NewProduction()
-	return &Invoker{
-		jsonrpc:  "2.0",
-		ctx:      ctx,
-		host:     host,
-		repo:     repo,
-		cli:      cli,
-		logger:   logger,
-		interval: 5 * time.Second,
+	invoker := &Invoker{
+		jsonrpc: "2.0",
+		ctx:     ctx,
+		host:    host,
+		repo:    repo,
+		cli:     cli,
+		logger:  logger,
+
+		endpoints: newEndpointPool(endpoints),
+
+		maxBackfillBlocks: c.maxBackfillBlocks,
+		maxBlocksPerTick:  c.maxBlocksPerTick,
+		methodOverrides:   c.methodOverrides,
+		nextID:            c.idGenerator,
+		batchPolicy:       c.batchPolicy,
+		withReceipts:      c.receipts,
+
+		subscriptions: make(map[string]*subscription),
+		wake:          make(chan struct{}, 1),
+		broadcaster:   newBroadcaster(c.notificationBuffer, c.notificationPolicy),
+		lastBlocks:    make(map[string]int),
+		triggers:      make(map[string]*trigger),
+		cache:         newBlockCache(c.interval),
 	}
+	invoker.interval.Store(int64(c.interval))
+	if c.adaptiveMax > 0 {
+		invoker.adaptive = newAdaptiveInterval(c.adaptiveMin, c.adaptiveMax)
+	}
+	if c.maxConcurrentSubscriptions > 0 {
+		invoker.scans = semaphore.NewWeighted(int64(c.maxConcurrentSubscriptions))
+	}
+	if c.retention > 0 {
+		invoker.startRetention(c.retention, c.retentionInterval)
+	}
+	return invoker
+}
+
+// MinInterval is the shortest poll interval accepted by SetInterval.
+const MinInterval = 100 * time.Millisecond
+
+// SetInterval changes the poll interval of the subscriptions, e.g. to slow
+// down polling while the node is rate limiting. The poll loop picks it up
+// after its next poll. Intervals below MinInterval are raised to it.
+func (s *Invoker) SetInterval(d time.Duration) {
+	d = max(d, MinInterval)
+	s.interval.Store(int64(d))
+	s.cache.setTTL(d)
 }
 
+// GetCurrentBlock is CurrentBlock, returning 0 on failure.
 func (s *Invoker) GetCurrentBlock() int {
-	request := map[string]interface{}{
-		"jsonrpc": s.jsonrpc,
-		"method":  "eth_blockNumber",
-		"params":  nil,
-		"id":      uuid.New().ID(),
-	}
-	var failureRaw rest.Raw
-	var out BlockNumber
-	_, err := s.cli.SetContext(s.ctx).Post("").
-		SetHeader("Content-Type", "application/json").
-		BodyJSON(&request).Receive(&out, &failureRaw)
+	current, err := s.CurrentBlock()
 	if err != nil {
-		s.logger.Error("failed to execute request", zap.Error(err))
+		s.logger.Error("failed to fetch current block", zap.Error(err), zap.String("cause", failureCause(err)))
 		return 0
 	}
-	if failureRaw != nil {
-		s.logger.Error("failed to fetch current block", zap.ByteString("raw", failureRaw))
-		return 0
+	return current
+}
+
+// CurrentBlock returns the number of the most recent block.
+func (s *Invoker) CurrentBlock() (int, error) {
+	return s.currentBlock(s.ctx)
+}
+
+// CurrentBlockContext is CurrentBlock calling the node with ctx, e.g. to
+// forward the request id of the caller and abort once it is done.
+func (s *Invoker) CurrentBlockContext(ctx context.Context) (int, error) {
+	return s.currentBlock(ctx)
+}
+
+// currentBlock is CurrentBlock, aborted once ctx is done.
+func (s *Invoker) currentBlock(ctx context.Context) (int, error) {
+	var result string
+	if err := s.Call(ctx, "eth_blockNumber", nil, &result); err != nil {
+		return 0, err
 	}
-	return utils.ConvertHexToDec(out.Result)
-}
-
-func (s *Invoker) Subscribe(address string) bool {
-	go func() {
-		ticker := time.NewTicker(time.Millisecond)
-		defer func() {
-			ticker.Stop()
-		}()
-		for {
-			select {
-			case <-s.ctx.Done():
-				return
-			case <-ticker.C:
-				ticker.Stop()
-				if err := s.subscribe(address); err != nil {
-					s.logger.Error("failed to subscribe", zap.Error(err))
-				}
-				ticker.Reset(s.interval)
-			}
-		}
-	}()
-	return true
+	current := utils.ConvertHexToDec(result)
+	s.stats.setCurrentBlock(current)
+	return current, nil
+}
+
+// Ping checks that the RPC node answers a lightweight eth_blockNumber call
+// before ctx is done.
+func (s *Invoker) Ping(ctx context.Context) error {
+	return s.Call(ctx, "eth_blockNumber", nil, nil)
+}
+
+// ChainID returns the chain id reported by the RPC node.
+func (s *Invoker) ChainID(ctx context.Context) (int, error) {
+	var result string
+	if err := s.Call(ctx, "eth_chainId", nil, &result); err != nil {
+		return 0, err
+	}
+	return utils.ConvertHexToDec(result), nil
+}
+
+// Watch returns a channel receiving every new transaction recorded for
+// address, and a function releasing it. Watching does not subscribe address.
+func (s *Invoker) Watch(address string) (<-chan Notification, func()) {
+	address = utils.NormalizeAddress(address)
+	return s.broadcaster.watch(address)
 }
 
+// GetTransactions is Transactions, returning nil on failure.
 func (s *Invoker) GetTransactions(address string) []Transaction {
-	block := s.GetBlock(address)
-	if block == nil {
+	transactions, err := s.Transactions(address)
+	if err != nil {
+		s.logger.Error("failed to fetch transactions", zap.String("address", address), zap.Error(err))
 		return nil
 	}
-	var transactions []Transaction
-	for _, value := range block.Result.Transactions {
-		request := map[string]interface{}{
-			"jsonrpc": s.jsonrpc,
-			"method":  "eth_getTransactionByHash",
-			"params":  []string{value},
-			"id":      uuid.New().ID(),
-		}
-		var failureRaw rest.Raw
-		var out TransactionResult
-		_, err := s.cli.SetContext(s.ctx).Post("").
-			SetHeader("Content-Type", "application/json").
-			BodyJSON(&request).Receive(&out, &failureRaw)
-		if err != nil {
-			s.logger.Error("failed to execute request", zap.Error(err))
-			return nil
-		}
-		if failureRaw != nil {
-			s.logger.Error("failed to fetch current block", zap.ByteString("raw", failureRaw))
-			return nil
-		}
-		transactions = append(transactions, out.Result)
-	}
 	return transactions
 }
 
-func (s *Invoker) subscribe(address string) error {
-	blockInfo, err := s.repo.GetBlockInfo(s.ctx, address)
-	if err != nil && !errors.Is(err, repositories.ErrNotFound) {
-		return err
-	}
+// Transactions returns the transactions recorded for a subscribed address.
+// It fails with ErrTransactionNotFound when the node no longer knows one of
+// them.
+func (s *Invoker) Transactions(address string) ([]Transaction, error) {
+	return s.TransactionsContext(s.ctx, address)
+}
 
-	hexCount := s.CountBlockTransaction(address)
-	if hexCount == "" {
-		return errors.New("failed to fetch block count")
+// TransactionsContext is Transactions calling the node with ctx.
+func (s *Invoker) TransactionsContext(ctx context.Context, address string) ([]Transaction, error) {
+	address = utils.NormalizeAddress(address)
+	if !utils.IsHexAddress(address) {
+		return nil, fmt.Errorf("%q: %w", address, ErrInvalidAddress)
+	}
+	blockTransactions, err := s.repo.GetBlockTransactions(ctx, address)
+	if err != nil {
+		return nil, fmt.Errorf("load transactions of %s: %w", address, err)
 	}
-	count := utils.ConvertHexToDec(hexCount)
+	return s.fetchTransactions(ctx, blockTransactions)
+}
 
-	if blockInfo != nil && blockInfo.Count == count {
+// GetBlock returns the block of hash address, or nil on failure.
+//
+// Deprecated: use GetBlockByHash, which reports failures.
+func (s *Invoker) GetBlock(address string) *BlockResult {
+	block, err := s.GetBlockByHash(s.ctx, address)
+	if err != nil {
+		s.logger.Error("failed to fetch block", zap.String("address", address), zap.Error(err))
 		return nil
 	}
+	return block
+}
 
-	var nexIndex int
-	if blockInfo != nil {
-		nexIndex = blockInfo.Count
-	}
-
-	var blockTransactions []*models.BlockTransaction
-	var latest string
-	for idx := nexIndex; idx < count; idx++ {
-		hexIndex := fmt.Sprintf("%#x", idx)
-		trans := s.GetTransactionByIndex(address, hexIndex)
-		blockTransactions = append(blockTransactions, &models.BlockTransaction{
-			BlockAddress:       address,
-			TransactionAddress: trans.Hash,
-			CreatedAt:          time.Now().UTC(),
-		})
-		latest = trans.Hash
-	}
-	_ = s.repo.CreateBlockTransactions(s.ctx, blockTransactions)
-	_ = s.repo.UpsertBlockInfo(s.ctx, &models.BlockInfo{
-		BlockAddress:             address,
-		Count:                    count,
-		LatestTransactionAddress: latest,
-	})
-	return nil
+// GetBlockByHash returns the block of hash with the hashes of its
+// transactions, or ErrBlockNotFound when the node does not know it.
+func (s *Invoker) GetBlockByHash(ctx context.Context, hash string) (*BlockResult, error) {
+	var out BlockResult
+	if err := send(ctx, s, "eth_getBlockByHash", []interface{}{hash, false}, &out); err != nil {
+		return nil, err
+	}
+	if out.Result == nil {
+		return nil, fmt.Errorf("block %s: %w", hash, ErrBlockNotFound)
+	}
+	return &out, nil
 }
 
-func (s *Invoker) GetBlock(address string) *BlockResult {
-	request := map[string]interface{}{
-		"jsonrpc": s.jsonrpc,
-		"method":  "eth_getBlockByHash",
-		"params":  []interface{}{address, false},
-		"id":      uuid.New().ID(),
+// GetBlockByNumber returns the block identified by tag with its full
+// transactions, or ErrBlockNotFound when it is not mined yet. Numbered blocks
+// fetched during the current poll cycle are served from memory.
+func (s *Invoker) GetBlockByNumber(ctx context.Context, tag BlockTag) (*FullBlockResult, error) {
+	if err := tag.Validate(); err != nil {
+		return nil, err
 	}
-	var failureRaw rest.Raw
-	var out BlockResult
-	_, err := s.cli.SetContext(s.ctx).Post("").
-		SetHeader("Content-Type", "application/json").
-		BodyJSON(&request).Receive(&out, &failureRaw)
-	if err != nil {
-		s.logger.Error("failed to execute request", zap.Error(err))
-		return nil
+	number, numbered := tag.Number()
+	if numbered {
+		if block, ok := s.cache.get(number); ok {
+			return block, nil
+		}
 	}
-	if failureRaw != nil {
-		s.logger.Error("failed to fetch block", zap.ByteString("raw", failureRaw))
-		return nil
+	var out FullBlockResult
+	if err := send(ctx, s, "eth_getBlockByNumber", []interface{}{tag, true}, &out); err != nil {
+		return nil, err
+	}
+	if out.Result == nil {
+		return nil, fmt.Errorf("block %s: %w", tag, ErrBlockNotFound)
+	}
+	if numbered {
+		s.cache.put(number, &out)
 	}
-	return &out
+	return &out, nil
 }
 
 func (s *Invoker) GetTransactionByIndex(address, index string) *Transaction {
-	request := map[string]interface{}{
-		"jsonrpc": s.jsonrpc,
-		"method":  "eth_getTransactionByBlockHashAndIndex",
-		"params":  []string{address, index},
-		"id":      uuid.New().ID(),
-	}
-	var failureRaw rest.Raw
 	var out TransactionResult
-	_, err := s.cli.SetContext(s.ctx).Post("").
-		SetHeader("Content-Type", "application/json").
-		BodyJSON(&request).Receive(&out, &failureRaw)
-	if err != nil {
-		s.logger.Error("failed to execute request", zap.Error(err))
+	if err := send(s.ctx, s, "eth_getTransactionByBlockHashAndIndex", []string{address, index}, &out); err != nil {
+		s.logger.Error("failed to fetch transaction", zap.Error(err))
 		return nil
 	}
-	if failureRaw != nil {
-		s.logger.Error("failed to fetch current block", zap.ByteString("raw", failureRaw))
-		return nil
+	return out.Result
+}
+
+// CountBlockTransaction returns the hex number of transactions of the block
+// hash, or "" on failure.
+//
+// Deprecated: use BlockTransactionCount, which also accepts block tags and
+// reports failures.
+func (s *Invoker) CountBlockTransaction(hash string) string {
+	var out CountBlockTransaction
+	if err := send(s.ctx, s, "eth_getBlockTransactionCountByHash", []string{hash}, &out); err != nil {
+		s.logger.Error("failed to fetch block count", zap.Error(err))
+		return ""
 	}
-	return &out.Result
+	return out.Result
 }
 
-func (s *Invoker) CountBlockTransaction(address string) string {
+// BlockTransactionCount returns the number of transactions of a block without
+// fetching it. blockTag is either a block tag, such as Latest or a
+// BlockNumberTag, or a block hash. A block unknown to the node fails with
+// ErrBlockNotFound.
+func (s *Invoker) BlockTransactionCount(blockTag BlockTag) (int, error) {
+	method := "eth_getBlockTransactionCountByNumber"
+	if utils.IsHexHash(string(blockTag)) {
+		method = "eth_getBlockTransactionCountByHash"
+	} else if err := blockTag.Validate(); err != nil {
+		return 0, err
+	}
+	var result *string
+	if err := s.Call(s.ctx, method, []interface{}{blockTag}, &result); err != nil {
+		return 0, err
+	}
+	if result == nil {
+		return 0, fmt.Errorf("block %s: %w", blockTag, ErrBlockNotFound)
+	}
+	count, err := utils.ParseHexBig(*result)
+	if err != nil || !count.IsInt64() {
+		return 0, fmt.Errorf("transaction count of block %s: %w: %s", blockTag, ErrUnexpectedResponse, *result)
+	}
+	return int(count.Int64()), nil
+}
+
+// send posts a JSON-RPC request for method through s and decodes the
+// response into out. Transport failures, error objects, non-success responses
+// and responses to another request id are returned as *CallError.
+func send[T any](ctx context.Context, s *Invoker, method string, params interface{}, out *RPCResponse[T]) (err error) {
+	defer observeRPC(method, time.Now(), &err)
+	defer func() {
+		s.stats.rpcDone(err)
+	}()
+
+	id := s.nextID()
 	request := map[string]interface{}{
 		"jsonrpc": s.jsonrpc,
-		"method":  "eth_getBlockTransactionCountByHash",
-		"params":  []string{address},
-		"id":      uuid.New().ID(),
+		"method":  s.methodName(method),
+		"params":  params,
+		"id":      id,
 	}
-	var failureRaw rest.Raw
-	var out CountBlockTransaction
-	_, err := s.cli.SetContext(s.ctx).Post("").
-		SetHeader("Content-Type", "application/json").
-		BodyJSON(&request).Receive(&out, &failureRaw)
+	var successRaw rest.Raw
+	failureRaw, err := s.post(s.callContext(ctx, method, params), &request, &successRaw, !nonIdempotentMethods[method])
 	if err != nil {
-		s.logger.Error("failed to execute request", zap.Error(err))
-		return ""
+		return &CallError{Method: method, Err: err}
 	}
 	if failureRaw != nil {
-		s.logger.Error("failed to fetch block count", zap.ByteString("raw", failureRaw))
-		return ""
+		return &CallError{Method: method, Err: responseError(failureRaw)}
 	}
-	return out.Result
+
+	if err := json.Unmarshal(successRaw, out); err != nil {
+		return &CallError{Method: method, Err: err}
+	}
+	if out.Error != nil {
+		// only reached with a success decider letting error objects through
+		return &CallError{Method: method, Err: out.Error}
+	}
+	if out.ID != id {
+		return &CallError{Method: method, Err: fmt.Errorf("%w: sent id %d, received %d", ErrUnexpectedResponse, id, out.ID)}
+	}
+	return nil
+}
+
+// callContext returns ctx describing the call of method for traces and
+// metrics.
+func (s *Invoker) callContext(ctx context.Context, method string, params interface{}) context.Context {
+	name := s.methodName(method)
+	return rest.WithMetricRoute(withRPCCall(ctx, name, params), name)
+}
+
+// methodName returns the name sent to the node for the standard method.
+func (s *Invoker) methodName(method string) string {
+	if override, ok := s.methodOverrides[method]; ok {
+		return override
+	}
+	return method
 }
@@ -0,0 +1,1689 @@
+package parser
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dungnh3/trustwallet-assignment/internal/models"
+	"github.com/dungnh3/trustwallet-assignment/internal/parser/testutil"
+	"github.com/dungnh3/trustwallet-assignment/internal/repositories"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+// testAddress is a valid account address, accepted by the exported methods.
+const testAddress = "0x00000000000000000000000000000000000000ab"
+
+func blockByNumber(params []json.RawMessage) interface{} {
+	var number string
+	json.Unmarshal(params[0], &number)
+	return map[string]interface{}{
+		"number": number,
+		"transactions": []map[string]string{
+			{"hash": "0xaa" + number[2:], "from": "0xabc", "to": "0xdef"},
+		},
+	}
+}
+
+func TestSubscribe_skipsProcessedBlocks(t *testing.T) {
+	rpc := testutil.NewServer(t)
+	rpc.Handle("eth_blockNumber", func([]json.RawMessage) interface{} { return "0xa" })
+	rpc.Handle("eth_getBlockByNumber", blockByNumber)
+
+	ctx := context.Background()
+	repo := repositories.New()
+	invoker := New(ctx, rpc.URL, repo).(*Invoker)
+
+	if err := invoker.subscribe(ctx, "0xabc"); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if count := rpc.Count("eth_getBlockByNumber"); count != 1 {
+		t.Fatalf("expected 1 block fetched, got %d", count)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := invoker.subscribe(ctx, "0xabc"); err != nil {
+			t.Fatalf("expected nil, got %v", err)
+		}
+	}
+	if count := rpc.Count("eth_getBlockByNumber"); count != 1 {
+		t.Errorf("expected no block re-fetched, got %d fetches", count)
+	}
+
+	// a restarted parser resumes from the persisted progress
+	restarted := New(ctx, rpc.URL, repo).(*Invoker)
+	if err := restarted.subscribe(ctx, "0xabc"); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if count := rpc.Count("eth_getBlockByNumber"); count != 1 {
+		t.Errorf("expected no block re-fetched after restart, got %d fetches", count)
+	}
+
+	rpc.Handle("eth_blockNumber", func([]json.RawMessage) interface{} { return fmt.Sprintf("%#x", 12) })
+	if err := invoker.subscribe(ctx, "0xabc"); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if count := rpc.Count("eth_getBlockByNumber"); count != 3 {
+		t.Errorf("expected only the 2 new blocks fetched, got %d fetches", count)
+	}
+	info, _ := repo.GetBlockInfo(ctx, "0xabc")
+	if info.LastProcessedBlock != 12 || info.Count != 3 {
+		t.Errorf("expected block 12 and 3 transactions, got %+v", info)
+	}
+}
+
+func TestPoll_sharedAcrossAddresses(t *testing.T) {
+	rpc := testutil.NewServer(t)
+	rpc.Handle("eth_blockNumber", func([]json.RawMessage) interface{} { return "0xc" })
+	rpc.Handle("eth_getBlockByNumber", blockByNumber)
+
+	ctx := context.Background()
+	repo := repositories.New()
+	invoker := New(ctx, rpc.URL, repo).(*Invoker)
+	// 0xabc is behind, 0xdef is up to date and 0x123 polls for the first time
+	repo.UpsertBlockInfo(ctx, &models.BlockInfo{BlockAddress: "0xabc", LastProcessedBlock: 9})
+	repo.UpsertBlockInfo(ctx, &models.BlockInfo{BlockAddress: "0xdef", LastProcessedBlock: 12})
+
+	subs := map[string]context.Context{"0xabc": ctx, "0xdef": ctx, "0x123": ctx}
+	if err := invoker.poll(ctx, subs); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if count := rpc.Count("eth_blockNumber"); count != 1 {
+		t.Errorf("expected a single block number call, got %d", count)
+	}
+	if count := rpc.Count("eth_getBlockByNumber"); count != 3 {
+		t.Errorf("expected blocks 10 to 12 fetched once, got %d fetches", count)
+	}
+	for address, expected := range map[string]int{"0xabc": 3, "0xdef": 0, "0x123": 0} {
+		info, _ := repo.GetBlockInfo(ctx, address)
+		if info.LastProcessedBlock != 12 || info.Count != expected {
+			t.Errorf("%s: expected block 12 and %d transactions, got %+v", address, expected, info)
+		}
+	}
+	for number := 10; number <= 12; number++ {
+		if _, err := repo.GetBlockByNumber(ctx, number); err != nil {
+			t.Errorf("expected block %d stored, got %v", number, err)
+		}
+	}
+}
+
+func TestWithMaxBlocksPerTick(t *testing.T) {
+	rpc := testutil.NewServer(t)
+	rpc.Handle("eth_blockNumber", func([]json.RawMessage) interface{} { return "0xe" })
+	rpc.Handle("eth_getBlockByNumber", blockByNumber)
+
+	ctx := context.Background()
+	repo := repositories.New()
+	invoker := New(ctx, rpc.URL, repo, WithMaxBlocksPerTick(2)).(*Invoker)
+	repo.UpsertBlockInfo(ctx, &models.BlockInfo{BlockAddress: "0xabc", LastProcessedBlock: 9})
+
+	for _, expected := range []struct{ last, backlog int }{{11, 3}, {13, 1}, {14, 0}} {
+		if err := invoker.subscribe(ctx, "0xabc"); err != nil {
+			t.Fatalf("expected nil, got %v", err)
+		}
+		info, _ := repo.GetBlockInfo(ctx, "0xabc")
+		if info.LastProcessedBlock != expected.last {
+			t.Errorf("expected block %d, got %d", expected.last, info.LastProcessedBlock)
+		}
+		if backlog := promtestutil.ToFloat64(blockBacklogGauge); int(backlog) != expected.backlog {
+			t.Errorf("expected a backlog of %d, got %v", expected.backlog, backlog)
+		}
+	}
+}
+
+// BenchmarkPoll_100Addresses reports the RPC calls made for 100 addresses
+// and one new block, polled each on its own as before the shared poll loop,
+// and together.
+func BenchmarkPoll_100Addresses(b *testing.B) {
+	subs := make(map[string]context.Context)
+	for i := 0; i < 100; i++ {
+		subs[fmt.Sprintf("0x%040x", i)] = context.Background()
+	}
+	polls := map[string]func(invoker *Invoker) error{
+		"per-address": func(invoker *Invoker) error {
+			for address, ctx := range subs {
+				if err := invoker.subscribe(ctx, address); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		"shared": func(invoker *Invoker) error {
+			return invoker.poll(context.Background(), subs)
+		},
+	}
+	for name, poll := range polls {
+		b.Run(name, func(b *testing.B) {
+			var tip atomic.Int64
+			rpc := testutil.NewServer(b)
+			rpc.Handle("eth_blockNumber", func([]json.RawMessage) interface{} {
+				return fmt.Sprintf("%#x", tip.Load())
+			})
+			rpc.Handle("eth_getBlockByNumber", blockByNumber)
+			invoker := New(context.Background(), rpc.URL, repositories.New()).(*Invoker)
+			invoker.logger = zap.NewNop()
+
+			tip.Store(1)
+			if err := poll(invoker); err != nil {
+				b.Fatal(err)
+			}
+			before := rpc.Count("eth_blockNumber") + rpc.Count("eth_getBlockByNumber")
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				tip.Add(1)
+				if err := poll(invoker); err != nil {
+					b.Fatal(err)
+				}
+			}
+			calls := rpc.Count("eth_blockNumber") + rpc.Count("eth_getBlockByNumber") - before
+			b.ReportMetric(float64(calls)/float64(b.N), "rpc-calls/op")
+		})
+	}
+}
+
+func TestGetBlockByNumber_cachedWithinPollCycle(t *testing.T) {
+	rpc := testutil.NewServer(t)
+	rpc.Handle("eth_blockNumber", func([]json.RawMessage) interface{} { return "0xa" })
+	rpc.Handle("eth_getBlockByNumber", blockByNumber)
+
+	ctx := context.Background()
+	invoker := New(ctx, rpc.URL, repositories.New()).(*Invoker)
+
+	addresses := []string{"0xabc", "0xdef", "0x123"}
+	for _, address := range addresses {
+		if err := invoker.subscribe(ctx, address); err != nil {
+			t.Fatalf("expected nil, got %v", err)
+		}
+	}
+	if count := rpc.Count("eth_getBlockByNumber"); count != 1 {
+		t.Errorf("expected 1 block fetch for %d subscriptions, got %d", len(addresses), count)
+	}
+
+	invoker.cache.ttl = 0
+	if _, err := invoker.GetBlockByNumber(ctx, BlockNumberTag(10)); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if count := rpc.Count("eth_getBlockByNumber"); count != 2 {
+		t.Errorf("expected expired block to be fetched again, got %d fetches", count)
+	}
+}
+
+func TestGetBlock_nullResult(t *testing.T) {
+	rpc := testutil.NewServer(t)
+	rpc.Handle("eth_getBlockByHash", func([]json.RawMessage) interface{} { return nil })
+	rpc.Handle("eth_getBlockByNumber", func([]json.RawMessage) interface{} { return nil })
+
+	ctx := context.Background()
+	invoker := New(ctx, rpc.URL, repositories.New()).(*Invoker)
+
+	if block := invoker.GetBlock("0xabc"); block != nil {
+		t.Errorf("expected nil block, got %+v", block)
+	}
+	if _, err := invoker.GetBlockByHash(ctx, "0xabc"); !errors.Is(err, ErrBlockNotFound) {
+		t.Errorf("expected ErrBlockNotFound, got %v", err)
+	}
+	if _, err := invoker.GetBlockByNumber(ctx, BlockNumberTag(10)); !errors.Is(err, ErrBlockNotFound) {
+		t.Errorf("expected ErrBlockNotFound, got %v", err)
+	}
+	if _, ok := invoker.cache.get(10); ok {
+		t.Error("expected unknown block not to be cached")
+	}
+}
+
+func TestTransactions_nullResult(t *testing.T) {
+	rpc := testutil.NewServer(t)
+	rpc.Handle("eth_getTransactionByHash", func([]json.RawMessage) interface{} { return nil })
+
+	ctx := context.Background()
+	repo := repositories.New()
+	repo.CreateBlockTransactions(ctx, []*models.BlockTransaction{
+		{BlockAddress: testAddress, TransactionAddress: "0xaa"},
+	})
+	invoker := New(ctx, rpc.URL, repo).(*Invoker)
+
+	if _, err := invoker.Transactions(testAddress); !errors.Is(err, ErrTransactionNotFound) {
+		t.Errorf("expected ErrTransactionNotFound, got %v", err)
+	}
+}
+
+func TestSetInterval(t *testing.T) {
+	invoker := New(context.Background(), "http://localhost", repositories.New()).(*Invoker)
+
+	invoker.SetInterval(time.Minute)
+	if got := time.Duration(invoker.interval.Load()); got != time.Minute {
+		t.Errorf("expected %s, got %s", time.Minute, got)
+	}
+	invoker.SetInterval(time.Millisecond)
+	if got := time.Duration(invoker.interval.Load()); got != MinInterval {
+		t.Errorf("expected interval raised to %s, got %s", MinInterval, got)
+	}
+}
+
+func TestSetInterval_runningLoop(t *testing.T) {
+	rpc := testutil.NewServer(t)
+	rpc.Result("eth_blockNumber", "0xa")
+	rpc.Handle("eth_getBlockByNumber", blockByNumber)
+	invoker := New(context.Background(), rpc.URL, repositories.New(), WithInterval(MinInterval)).(*Invoker)
+	t.Cleanup(func() { invoker.Close() })
+
+	invoker.Subscribe(testAddress)
+	deadline := time.Now().Add(5 * time.Second)
+	for rpc.Count("eth_blockNumber") < 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the loop to poll every interval")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the poll already waiting for the old interval still runs
+	invoker.SetInterval(time.Hour)
+	time.Sleep(3 * MinInterval)
+	polls := rpc.Count("eth_blockNumber")
+	time.Sleep(5 * MinInterval)
+	if n := rpc.Count("eth_blockNumber"); n != polls {
+		t.Errorf("expected the loop to wait for the new interval, got %d more polls", n-polls)
+	}
+}
+
+// TestInvoker_concurrentCalls is meant to be run with -race.
+func TestInvoker_concurrentCalls(t *testing.T) {
+	rpc := testutil.NewServer(t)
+	rpc.Handle("eth_blockNumber", func([]json.RawMessage) interface{} { return "0xa" })
+	rpc.Handle("eth_getTransactionByHash", func(params []json.RawMessage) interface{} {
+		var hash string
+		json.Unmarshal(params[0], &hash)
+		return map[string]string{"hash": hash}
+	})
+
+	ctx := context.Background()
+	repo := repositories.New()
+	repo.CreateBlockTransactions(ctx, []*models.BlockTransaction{
+		{BlockAddress: testAddress, TransactionAddress: "0xaa"},
+	})
+	invoker := New(ctx, rpc.URL, repo).(*Invoker)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := invoker.CurrentBlock(); err != nil {
+				t.Errorf("expected nil, got %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			transactions, err := invoker.Transactions(testAddress)
+			if err != nil || len(transactions) != 1 || transactions[0].Hash != "0xaa" {
+				t.Errorf("expected transaction 0xaa, got %v, %v", transactions, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestInvoker_rejectsInvalidAddresses(t *testing.T) {
+	rpc := testutil.NewServer(t)
+	invoker := New(context.Background(), rpc.URL, repositories.New()).(*Invoker)
+
+	if invoker.Subscribe("0x12ebe0a") {
+		t.Error("expected subscription of an invalid address to fail")
+	}
+	if invoker.SubscribeFromBlock("0x12ebe0a", 1) {
+		t.Error("expected subscription of an invalid address to fail")
+	}
+	if _, err := invoker.Transactions("0x12ebe0a"); !errors.Is(err, ErrInvalidAddress) {
+		t.Errorf("expected ErrInvalidAddress, got %v", err)
+	}
+	invoker.Close()
+}
+
+func TestBlockTag_Validate(t *testing.T) {
+	cases := []struct {
+		tag   BlockTag
+		valid bool
+	}{
+		{Latest, true},
+		{Earliest, true},
+		{Pending, true},
+		{BlockNumberTag(0), true},
+		{BlockNumberTag(1234), true},
+		{"", false},
+		{"safe", false},
+		{"1234", false},
+		{"0xzz", false},
+		{"0x7fffffffffffffff", true},
+		// wider than 63 bits
+		{"0x10000000000000000", false},
+	}
+	for _, c := range cases {
+		err := c.tag.Validate()
+		if c.valid && err != nil {
+			t.Errorf("%q: expected nil, got %v", c.tag, err)
+		}
+		if !c.valid && !errors.Is(err, ErrInvalidBlockTag) {
+			t.Errorf("%q: expected ErrInvalidBlockTag, got %v", c.tag, err)
+		}
+	}
+}
+
+func TestBroadcaster_policies(t *testing.T) {
+	ctx := context.Background()
+	notification := func(hash string) Notification {
+		return Notification{Address: testAddress, Transaction: Transaction{Hash: hash}}
+	}
+
+	b := newBroadcaster(1, DropOldest)
+	ch, release := b.watch(testAddress)
+	b.publish(ctx, notification("0x1"))
+	b.publish(ctx, notification("0x2"))
+	if n := <-ch; n.Transaction.Hash != "0x2" {
+		t.Errorf("DropOldest: expected 0x2, got %s", n.Transaction.Hash)
+	}
+	release()
+
+	b = newBroadcaster(1, DropNewest)
+	ch, release = b.watch(testAddress)
+	b.publish(ctx, notification("0x1"))
+	b.publish(ctx, notification("0x2"))
+	if n := <-ch; n.Transaction.Hash != "0x1" {
+		t.Errorf("DropNewest: expected 0x1, got %s", n.Transaction.Hash)
+	}
+	release()
+
+	b = newBroadcaster(1, BlockUntilDelivered)
+	ch, release = b.watch(testAddress)
+	b.publish(ctx, notification("0x1"))
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		b.publish(ctx, notification("0x2"))
+	}()
+	if n := <-ch; n.Transaction.Hash != "0x1" {
+		t.Errorf("BlockUntilDelivered: expected 0x1, got %s", n.Transaction.Hash)
+	}
+	if n := <-ch; n.Transaction.Hash != "0x2" {
+		t.Errorf("BlockUntilDelivered: expected 0x2, got %s", n.Transaction.Hash)
+	}
+	<-published
+
+	// a release unblocks a pending publish
+	b.publish(ctx, notification("0x3"))
+	published = make(chan struct{})
+	go func() {
+		defer close(published)
+		b.publish(ctx, notification("0x4"))
+	}()
+	release()
+	<-published
+}
+
+func TestSend_rpcError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"jsonrpc": "2.0", "id": 1, "error": {"code": -32005, "message": "limit exceeded"}}`)
+	}))
+	defer server.Close()
+
+	invoker := New(context.Background(), server.URL, repositories.New()).(*Invoker)
+	_, err := invoker.CurrentBlock()
+	var callErr *CallError
+	if !errors.As(err, &callErr) || callErr.Method != "eth_blockNumber" || !errors.Is(err, ErrUnexpectedResponse) {
+		t.Errorf("expected eth_blockNumber CallError wrapping ErrUnexpectedResponse, got %v", err)
+	}
+}
+
+func TestRPCSpanAttributes(t *testing.T) {
+	cases := []struct {
+		method   string
+		params   interface{}
+		expected []attribute.KeyValue
+	}{
+		{"eth_blockNumber", nil, []attribute.KeyValue{attribute.String("rpc.method", "eth_blockNumber")}},
+		{"eth_getBlockByHash", []interface{}{"0xabc", false}, []attribute.KeyValue{
+			attribute.String("rpc.method", "eth_getBlockByHash"), attribute.String("eth.block", "0xabc"),
+		}},
+		{"eth_getBlockByNumber", []interface{}{BlockNumberTag(10), true}, []attribute.KeyValue{
+			attribute.String("rpc.method", "eth_getBlockByNumber"), attribute.String("eth.block", "0xa"),
+		}},
+		{"eth_getTransactionByHash", []string{"0xaa"}, []attribute.KeyValue{attribute.String("rpc.method", "eth_getTransactionByHash")}},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req = req.WithContext(withRPCCall(req.Context(), c.method, c.params))
+		if attrs := rpcSpanAttributes(req); !reflect.DeepEqual(c.expected, attrs) {
+			t.Errorf("%s: expected %v, got %v", c.method, c.expected, attrs)
+		}
+	}
+}
+
+func TestTransaction_Direction(t *testing.T) {
+	const other = "0x00000000000000000000000000000000000000cd"
+	cases := []struct {
+		from, to string
+		expected Direction
+	}{
+		{other, testAddress, Incoming},
+		{testAddress, other, Outgoing},
+		{testAddress, testAddress, Self},
+		{other, other, Unrelated},
+		{other, "", Unrelated},
+		{strings.ToUpper(other), "0X00000000000000000000000000000000000000AB", Incoming},
+	}
+	for _, c := range cases {
+		trans := Transaction{From: c.from, To: c.to}
+		if direction := trans.Direction(testAddress); direction != c.expected {
+			t.Errorf("%s -> %s: expected %s, got %s", c.from, c.to, c.expected, direction)
+		}
+	}
+}
+
+func TestTransaction_contractCreation(t *testing.T) {
+	// as sent by geth for a contract deployment
+	const creation = `{
+		"blockHash": "0x1d59ff54b1eb26b013ce3cb5fc9dab3705b415a67127a003c3e61eb445bb8df2",
+		"blockNumber": "0x5daf3b",
+		"from": "0xa7d9ddbe1f17865597fbd27ec712455208b6b76d",
+		"gas": "0x2dc6c0",
+		"gasPrice": "0x4a817c800",
+		"hash": "0x88df016429689c079f3b2f6ad39fa052532c56795b733da78a91ebe6a713944b",
+		"input": "0x6080604052348015600f57600080fd5b50603f80601d6000396000f3fe",
+		"nonce": "0x15",
+		"to": null,
+		"transactionIndex": "0x41",
+		"value": "0x0",
+		"type": "0x0",
+		"chainId": "0x1",
+		"v": "0x25",
+		"r": "0x1b5e176d927f8e9ab405058b2d2457392da3e20f328b16ddabcebc33eaac5fea",
+		"s": "0x4ba69724e8f69de52f0125ad8b3c5c2cef33019bac3249e2c0a2192766d1721c"
+	}`
+	var trans Transaction
+	if err := json.Unmarshal([]byte(creation), &trans); err != nil {
+		t.Fatal(err)
+	}
+	if !trans.IsContractCreation() || trans.To != "" {
+		t.Errorf("expected a contract creation, got to %q", trans.To)
+	}
+	if direction := trans.Direction("0xa7d9ddbe1f17865597fbd27ec712455208b6b76d"); direction != Outgoing {
+		t.Errorf("expected the deployment to be outgoing, got %s", direction)
+	}
+	encoded, _ := json.Marshal(trans)
+	if !strings.Contains(string(encoded), `"to":null`) {
+		t.Errorf("expected to to be encoded as null, got %s", encoded)
+	}
+
+	// a missing to is not a contract creation
+	var malformed Transaction
+	json.Unmarshal([]byte(`{"hash": "0x1", "from": "0x2"}`), &malformed)
+	var transfer Transaction
+	json.Unmarshal([]byte(`{"hash": "0x1", "from": "0x2", "to": "0x3"}`), &transfer)
+	if malformed.IsContractCreation() || transfer.IsContractCreation() || transfer.To != "0x3" {
+		t.Errorf("expected no contract creation, got %+v and %+v", malformed, transfer)
+	}
+}
+
+func TestGetTransactionsFiltered(t *testing.T) {
+	rpc := testutil.NewServer(t)
+	rpc.Handle("eth_getTransactionByHash", func(params []json.RawMessage) interface{} {
+		var hash string
+		json.Unmarshal(params[0], &hash)
+		return map[string]string{"hash": hash}
+	})
+
+	ctx := context.Background()
+	repo := repositories.New()
+	repo.CreateBlockTransactions(ctx, []*models.BlockTransaction{
+		{BlockAddress: testAddress, TransactionAddress: "0x01", Direction: string(Incoming)},
+		{BlockAddress: testAddress, TransactionAddress: "0x02", Direction: string(Outgoing)},
+		{BlockAddress: testAddress, TransactionAddress: "0x03", Direction: string(Incoming)},
+		{BlockAddress: testAddress, TransactionAddress: "0x04", Direction: string(Incoming)},
+	})
+	invoker := New(ctx, rpc.URL, repo).(*Invoker)
+
+	hashes := func(page *TransactionPage) []string {
+		var out []string
+		for _, trans := range page.Transactions {
+			out = append(out, trans.Hash)
+		}
+		return out
+	}
+
+	page, err := invoker.GetTransactionsFiltered(testAddress, TransactionQuery{Direction: Incoming, Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"0x01", "0x03"}; !reflect.DeepEqual(expected, hashes(page)) {
+		t.Errorf("expected %v, got %v", expected, hashes(page))
+	}
+	page, err = invoker.GetTransactionsFiltered(testAddress, TransactionQuery{Direction: Incoming, Limit: 2, Cursor: page.NextCursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"0x04"}; !reflect.DeepEqual(expected, hashes(page)) || page.NextCursor != 0 {
+		t.Errorf("expected %v without cursor, got %v and cursor %d", expected, hashes(page), page.NextCursor)
+	}
+
+	now := time.Now()
+	for _, q := range []TransactionQuery{
+		{Direction: "sideways"},
+		{Limit: -1},
+		{Offset: 1, Cursor: 1},
+		{Since: now, Until: now.Add(-time.Second)},
+	} {
+		if _, err := invoker.GetTransactionsFiltered(testAddress, q); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("%+v: expected ErrInvalidQuery, got %v", q, err)
+		}
+	}
+}
+
+func TestRetention(t *testing.T) {
+	ctx := context.Background()
+	repo := repositories.New()
+	repo.CreateBlockTransactions(ctx, []*models.BlockTransaction{
+		{BlockAddress: testAddress, TransactionAddress: "0x01", CreatedAt: time.Now().Add(-time.Hour)},
+		{BlockAddress: testAddress, TransactionAddress: "0x02", CreatedAt: time.Now()},
+	})
+	invoker := New(ctx, "http://localhost", repo, WithRetention(time.Minute, 10*time.Millisecond)).(*Invoker)
+	defer invoker.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		kept, _ := repo.GetBlockTransactions(ctx, testAddress)
+		if len(kept) == 1 && kept[0].TransactionAddress == "0x02" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected only 0x02 kept, got %d transactions", len(kept))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWithIDGenerator(t *testing.T) {
+	var ids []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID int `json:"id"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		ids = append(ids, req.ID)
+		fmt.Fprint(w, `{"jsonrpc": "2.0", "id": 7, "result": "0x10"}`)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	invoker := New(ctx, server.URL, repositories.New(), WithIDGenerator(func() int { return 7 })).(*Invoker)
+	if current, err := invoker.CurrentBlock(); err != nil || current != 16 {
+		t.Errorf("expected block 16, got %d, %v", current, err)
+	}
+
+	invoker = New(ctx, server.URL, repositories.New()).(*Invoker)
+	if _, err := invoker.CurrentBlock(); !errors.Is(err, ErrUnexpectedResponse) {
+		t.Errorf("expected ErrUnexpectedResponse for another id, got %v", err)
+	}
+	if expected := []int{7, 1}; !reflect.DeepEqual(expected, ids) {
+		t.Errorf("expected ids %v, got %v", expected, ids)
+	}
+}
+
+// TestSend_requestBody pins the serialized request: map keys, including
+// those of the params, are encoded sorted, so the payload of a call never
+// varies.
+func TestSend_requestBody(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		fmt.Fprint(w, `{"jsonrpc": "2.0", "id": 7, "result": "0x"}`)
+	}))
+	defer server.Close()
+	invoker := New(context.Background(), server.URL, repositories.New(), WithIDGenerator(func() int { return 7 })).(*Invoker)
+
+	for i := 0; i < 10; i++ {
+		if _, err := invoker.EthCall(testAddress, "0x06fdde03", Latest); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := `{"id":7,"jsonrpc":"2.0","method":"eth_call","params":[{"data":"0x06fdde03","to":"` + testAddress + `"},"latest"]}` + "\n"
+	for _, body := range bodies {
+		if body != expected {
+			t.Fatalf("expected body %q, got %q", expected, body)
+		}
+	}
+}
+
+func TestBatchCall(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqs []struct {
+			ID     int    `json:"id"`
+			Method string `json:"method"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&reqs); err != nil || len(reqs) != 3 {
+			t.Errorf("expected a batch of 3 requests, got %v, %v", reqs, err)
+			return
+		}
+		// answered out of order, without the last one
+		fmt.Fprintf(w, `[{"jsonrpc": "2.0", "id": %d, "error": {"code": 3, "message": "execution reverted"}},
+			{"jsonrpc": "2.0", "id": %d, "result": "0x10"}]`, reqs[1].ID, reqs[0].ID)
+	}))
+	defer server.Close()
+
+	invoker := New(context.Background(), server.URL, repositories.New()).(*Invoker)
+	var number string
+	batch := []BatchElem{
+		{Method: "eth_blockNumber", Result: &number},
+		{Method: "eth_call", Params: []interface{}{map[string]string{"to": testAddress}, "latest"}},
+		{Method: "eth_chainId"},
+	}
+	if err := invoker.BatchCall(context.Background(), batch); err != nil {
+		t.Fatal(err)
+	}
+	if batch[0].Error != nil || number != "0x10" {
+		t.Errorf("expected 0x10, got %q, %v", number, batch[0].Error)
+	}
+	var rpcErr *RPCError
+	if !errors.As(batch[1].Error, &rpcErr) || rpcErr.Code != 3 {
+		t.Errorf("expected an RPCError with code 3, got %v", batch[1].Error)
+	}
+	if !errors.Is(batch[2].Error, ErrUnexpectedResponse) {
+		t.Errorf("expected ErrUnexpectedResponse without response, got %v", batch[2].Error)
+	}
+}
+
+func TestBatchCall_partialFailurePolicy(t *testing.T) {
+	// answers every other call of the batch, in reverse order
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqs []struct {
+			ID     int    `json:"id"`
+			Method string `json:"method"`
+		}
+		json.NewDecoder(r.Body).Decode(&reqs)
+		var resps []map[string]interface{}
+		for i := len(reqs) - 1; i >= 0; i-- {
+			if i%2 == 0 {
+				result := map[string]string{"eth_blockNumber": "0x10", "eth_chainId": "0x1"}[reqs[i].Method]
+				resps = append(resps, map[string]interface{}{"jsonrpc": "2.0", "id": reqs[i].ID, "result": result})
+			}
+		}
+		json.NewEncoder(w).Encode(resps)
+	}))
+	defer server.Close()
+
+	newBatch := func(results []string) []BatchElem {
+		batch := make([]BatchElem, len(results))
+		for i := range batch {
+			batch[i] = BatchElem{Method: "eth_blockNumber", Result: &results[i]}
+			if i == 2 {
+				batch[i].Method = "eth_chainId"
+			}
+		}
+		return batch
+	}
+
+	results := make([]string, 4)
+	batch := newBatch(results)
+	invoker := New(context.Background(), server.URL, repositories.New()).(*Invoker)
+	if err := invoker.BatchCall(context.Background(), batch); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"0x10", "", "0x1", ""}; !reflect.DeepEqual(expected, results) {
+		t.Errorf("expected %v matched by id, got %v", expected, results)
+	}
+	for i, elem := range batch {
+		if missing := errors.Is(elem.Error, ErrMissingResponse); missing != (i%2 == 1) {
+			t.Errorf("call %d: unexpected error %v", i, elem.Error)
+		}
+	}
+
+	invoker = New(context.Background(), server.URL, repositories.New(), WithBatchPartialFailurePolicy(FailOnMissing)).(*Invoker)
+	if err := invoker.BatchCall(context.Background(), newBatch(make([]string, 4))); !errors.Is(err, ErrMissingResponse) {
+		t.Errorf("expected ErrMissingResponse, got %v", err)
+	}
+}
+
+func TestEthCall(t *testing.T) {
+	// abi encoding of the string "insufficient balance"
+	const reason = "0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000014" +
+		"696e73756666696369656e742062616c616e6365000000000000000000000000"
+	rpc := testutil.NewServer(t)
+	rpc.Handle("eth_call", func(params []json.RawMessage) interface{} {
+		return "0x00000000000000000000000000000000000000000000000000000000000f4240"
+	})
+	invoker := New(context.Background(), rpc.URL, repositories.New()).(*Invoker)
+
+	result, err := invoker.EthCall(testAddress, "0x70a08231", Latest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance, err := DecodeUint256(result); err != nil || balance.Int64() != 1000000 {
+		t.Errorf("expected 1000000, got %v, %v", balance, err)
+	}
+	if s, err := DecodeString("0x" + reason); err != nil || s != "insufficient balance" {
+		t.Errorf("expected the decoded string, got %q, %v", s, err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"jsonrpc": "2.0", "id": 1, "error": {"code": 3, "message": "execution reverted", "data": "%s"}}`,
+			errorSelector+reason)
+	}))
+	defer server.Close()
+	invoker = New(context.Background(), server.URL, repositories.New()).(*Invoker)
+	_, err = invoker.EthCall(testAddress, "0xa9059cbb", Latest)
+	var revert *RevertError
+	if !errors.As(err, &revert) || revert.Reason != "insufficient balance" {
+		t.Errorf("expected a RevertError with its reason, got %v", err)
+	}
+}
+
+func TestTokenInfo(t *testing.T) {
+	rpc := testutil.NewServer(t)
+	rpc.Handle("eth_call", func(params []json.RawMessage) interface{} {
+		var call struct {
+			Data string `json:"data"`
+		}
+		json.Unmarshal(params[0], &call)
+		switch call.Data {
+		case decimalsSelector:
+			return "0x0000000000000000000000000000000000000000000000000000000000000012"
+		case symbolSelector:
+			// bytes32 "MKR"
+			return "0x4d4b520000000000000000000000000000000000000000000000000000000000"
+		default:
+			// name() is not implemented
+			return "0x"
+		}
+	})
+	invoker := New(context.Background(), rpc.URL, repositories.New()).(*Invoker)
+
+	for i := 0; i < 2; i++ {
+		info, err := invoker.TokenInfo(testAddress)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := (TokenInfo{Contract: testAddress, Symbol: "MKR", Decimals: 18}); info != expected {
+			t.Errorf("expected %+v, got %+v", expected, info)
+		}
+	}
+	if calls := rpc.Count("eth_call"); calls != 3 {
+		t.Errorf("expected the second lookup to be cached, got %d calls", calls)
+	}
+}
+
+func TestEstimateGas(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Params []map[string]string `json:"params"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Params[0]["value"] == "0xde0b6b3a7640000" {
+			fmt.Fprint(w, `{"jsonrpc": "2.0", "id": 1, "error": {"code": -32000, "message": "execution reverted: too much"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"jsonrpc": "2.0", "id": 2, "result": "0x5208"}`)
+	}))
+	defer server.Close()
+	invoker := New(context.Background(), server.URL, repositories.New()).(*Invoker)
+
+	_, err := invoker.EstimateGas(CallParams{To: testAddress, Value: big.NewInt(1e18)})
+	var revert *RevertError
+	if !errors.As(err, &revert) || revert.Reason != "too much" {
+		t.Errorf("expected a RevertError with its reason, got %v", err)
+	}
+	gas, err := invoker.EstimateGas(CallParams{To: testAddress, Value: big.NewInt(1)})
+	if err != nil || gas.Int64() != 21000 {
+		t.Errorf("expected 21000, got %v, %v", gas, err)
+	}
+}
+
+func TestSendRawTransaction(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		fmt.Fprint(w, `{"jsonrpc": "2.0", "id": 1, "error": {"code": -32000, "message": "nonce too low: next nonce 5, tx nonce 4"}}`)
+	}))
+	defer server.Close()
+	invoker := New(context.Background(), server.URL, repositories.New()).(*Invoker)
+
+	for _, tx := range []string{"", "f86b", "0xf86", "0xzz"} {
+		if _, err := invoker.SendRawTransaction(tx); !errors.Is(err, ErrInvalidTransaction) {
+			t.Errorf("%q: expected ErrInvalidTransaction, got %v", tx, err)
+		}
+	}
+	_, err := invoker.SendRawTransaction("0xf86b")
+	var rpcErr *RPCError
+	if !errors.Is(err, ErrNonceTooLow) || !errors.As(err, &rpcErr) {
+		t.Errorf("expected ErrNonceTooLow with the RPCError, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected a single attempt, got %d", calls)
+	}
+}
+
+func TestNonceManager(t *testing.T) {
+	rpc := testutil.NewServer(t)
+	rpc.Handle("eth_getTransactionCount", func(params []json.RawMessage) interface{} {
+		return "0x5"
+	})
+	rpc.Handle("eth_sendRawTransaction", func(params []json.RawMessage) interface{} {
+		return "0xabc"
+	})
+	invoker := New(context.Background(), rpc.URL, repositories.New()).(*Invoker)
+	nonces := NewNonceManager(invoker)
+
+	for _, expected := range []uint64{5, 6} {
+		if nonce, err := nonces.NextNonce(testAddress); err != nil || nonce != expected {
+			t.Errorf("expected nonce %d, got %d, %v", expected, nonce, err)
+		}
+	}
+	var signed uint64
+	_, err := nonces.SendTransaction(testAddress, func(nonce uint64) (string, error) {
+		signed = nonce
+		return "0xf86b", nil
+	})
+	if err != nil || signed != 7 {
+		t.Errorf("expected to sign with nonce 7, got %d, %v", signed, err)
+	}
+	if calls := rpc.Count("eth_getTransactionCount"); calls != 1 {
+		t.Errorf("expected the nonce to be fetched once, got %d calls", calls)
+	}
+
+	nonces.Reset(testAddress)
+	if nonce, err := nonces.NextNonce(testAddress); err != nil || nonce != 5 {
+		t.Errorf("expected the nonce to be fetched again, got %d, %v", nonce, err)
+	}
+}
+
+func TestClose_abortsInFlightPoll(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the server only notices the client going away once the body is read
+		io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	invoker := New(context.Background(), server.URL, repositories.New()).(*Invoker)
+	invoker.Subscribe(testAddress)
+	time.Sleep(50 * time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		invoker.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("expected Close to abort the poll waiting for the node")
+	}
+}
+
+func TestGetCurrentBlock(t *testing.T) {
+	rpc := testutil.NewServer(t)
+	rpc.Result("eth_blockNumber", "0x1b4")
+	invoker := New(context.Background(), rpc.URL, repositories.New()).(*Invoker)
+
+	if current := invoker.GetCurrentBlock(); current != 436 {
+		t.Errorf("expected block 436, got %d", current)
+	}
+	rpc.Fail("eth_blockNumber", -32005, "limit exceeded")
+	if current := invoker.GetCurrentBlock(); current != 0 {
+		t.Errorf("expected 0 on failure, got %d", current)
+	}
+	_, err := invoker.CurrentBlock()
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != -32005 {
+		t.Errorf("expected the RPCError, got %v", err)
+	}
+	rpc.AssertNotCalled("eth_getBlockByNumber")
+}
+
+func TestSubscribe_polls(t *testing.T) {
+	rpc := testutil.NewServer(t)
+	rpc.Result("eth_blockNumber", "0xa")
+	rpc.Handle("eth_getBlockByNumber", blockByNumber)
+
+	ctx := context.Background()
+	repo := repositories.New()
+	invoker := New(ctx, rpc.URL, repo).(*Invoker)
+	defer invoker.Close()
+	if !invoker.Subscribe(testAddress) {
+		t.Fatal("expected the address to be subscribed")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if info, err := repo.GetBlockInfo(ctx, testAddress); err == nil && info.LastProcessedBlock == 10 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected block 10 to be processed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	rpc.AssertCalled("eth_getBlockByNumber", "0xa", true)
+}
+
+func TestSubscribe_checksummedAddress(t *testing.T) {
+	const checksummed = "0x52908400098527886E0F7030069857D2E4169EE7"
+	lower := strings.ToLower(checksummed)
+	rpc := testutil.NewServer(t)
+	rpc.Result("eth_blockNumber", "0xa")
+	rpc.Result("eth_getBlockByNumber", map[string]interface{}{
+		"number":       "0xa",
+		"transactions": []map[string]string{{"hash": "0xaa", "from": lower, "to": "0xdef"}},
+	})
+	rpc.Result("eth_getTransactionByHash", map[string]string{"hash": "0xaa", "from": lower, "to": "0xdef"})
+
+	ctx := context.Background()
+	repo := repositories.New()
+	invoker := New(ctx, rpc.URL, repo).(*Invoker)
+	defer invoker.Close()
+	if !invoker.Subscribe(checksummed) {
+		t.Fatal("expected the address to be subscribed")
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		if info, err := repo.GetBlockInfo(ctx, lower); err == nil && info.LastProcessedBlock == 10 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected block 10 to be processed under the lowercase address")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := invoker.SubscribeE(ctx, lower); !errors.Is(err, ErrAlreadySubscribed) {
+		t.Errorf("expected the lowercase address to be already subscribed, got %v", err)
+	}
+	transactions, err := invoker.Transactions(lower)
+	if err != nil || len(transactions) != 1 || transactions[0].Hash != "0xaa" {
+		t.Errorf("expected the transaction recorded for the checksummed address, got %v, %v", transactions, err)
+	}
+	if !invoker.Unsubscribe(lower) {
+		t.Error("expected the lowercase address to unsubscribe the checksummed one")
+	}
+}
+
+func TestFailureCause(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+	invoker := New(context.Background(), server.URL, repositories.New()).(*Invoker)
+	if _, err := invoker.CurrentBlock(); failureCause(err) != "unreachable" {
+		t.Errorf("expected the node to be unreachable, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	blocked := make(chan struct{})
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-blocked }))
+	defer server.Close()
+	defer close(blocked)
+	invoker = New(context.Background(), server.URL, repositories.New()).(*Invoker)
+	if err := invoker.Call(ctx, "eth_blockNumber", nil, nil); failureCause(err) != "timeout" {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+}
+
+func TestFilterLogs(t *testing.T) {
+	const (
+		transfer = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+		approval = "0x8c5be1e5ebec7d5bd14f71427d1e84f3dd0314c0f7b2291e5b200ac8c7c3b925"
+		sender   = "0x00000000000000000000000000000000000000000000000000000000000000cd"
+		receiver = "0x00000000000000000000000000000000000000000000000000000000000000AB"
+	)
+	rpc := testutil.NewServer(t)
+	rpc.Result("eth_getTransactionReceipt", map[string]interface{}{
+		"transactionHash": "0xaa",
+		"status":          "0x1",
+		"logs": []map[string]interface{}{
+			{"logIndex": "0x0", "topics": []string{approval, sender, receiver}},
+			{"logIndex": "0x1", "topics": []string{transfer, sender, receiver}},
+			{"logIndex": "0x2", "topics": []string{transfer, sender, sender}},
+			{"logIndex": "0x3", "topics": []string{}},
+		},
+	})
+	invoker := New(context.Background(), rpc.URL, repositories.New()).(*Invoker)
+	receipt, err := invoker.GetTransactionReceipt("0xaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var indexes []string
+	for _, log := range FilterLogs(receipt.Logs, "Transfer(address,address,uint256)", "") {
+		indexes = append(indexes, log.LogIndex)
+	}
+	if expected := []string{"0x1", "0x2"}; !reflect.DeepEqual(expected, indexes) {
+		t.Errorf("expected the transfers %v, got %v", expected, indexes)
+	}
+	logs := FilterLogs(receipt.Logs, "Transfer(address,address,uint256)", testAddress)
+	if len(logs) != 1 || logs[0].LogIndex != "0x1" {
+		t.Errorf("expected the transfer to %s, got %+v", testAddress, logs)
+	}
+
+	rpc.Result("eth_getTransactionReceipt", nil)
+	if _, err := invoker.GetTransactionReceipt("0xbb"); !errors.Is(err, ErrReceiptNotFound) {
+		t.Errorf("expected ErrReceiptNotFound, got %v", err)
+	}
+}
+
+func TestWithMethodOverrides(t *testing.T) {
+	rpc := testutil.NewServer(t)
+	rpc.Result("custom_blockNumber", "0x1")
+	rpc.Result("eth_chainId", "0x1")
+	invoker := New(context.Background(), rpc.URL, repositories.New(), WithMethodOverrides(map[string]string{
+		"eth_blockNumber": "custom_blockNumber",
+		"eth_chainId":     "",
+	})).(*Invoker)
+
+	if _, err := invoker.CurrentBlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := invoker.BatchCall(context.Background(), []BatchElem{{Method: "eth_blockNumber"}}); err != nil {
+		t.Fatal(err)
+	}
+	if n := rpc.Count("custom_blockNumber"); n != 2 {
+		t.Errorf("expected 2 calls of the overridden name, got %d", n)
+	}
+	rpc.AssertNotCalled("eth_blockNumber")
+
+	// an empty override keeps the standard name
+	if _, err := invoker.ChainID(context.Background()); err != nil {
+		t.Errorf("expected the standard name, got %v", err)
+	}
+}
+
+func TestWithAuthHeader(t *testing.T) {
+	rpc := testutil.NewServer(t)
+	rpc.Result("eth_blockNumber", "0x1")
+
+	invoker := New(context.Background(), rpc.URL, repositories.New(), WithAuthHeader("X-Api-Key", "secret")).(*Invoker)
+	if _, err := invoker.CurrentBlock(); err != nil {
+		t.Fatal(err)
+	}
+	invoker = New(context.Background(), rpc.URL, repositories.New(), WithBasicAuth("user", "pass")).(*Invoker)
+	if _, err := invoker.CurrentBlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := rpc.Calls("eth_blockNumber")
+	if key := calls[0].Header.Get("X-Api-Key"); key != "secret" {
+		t.Errorf("expected the API key header, got %q", key)
+	}
+	request := &http.Request{Header: calls[1].Header}
+	if username, password, ok := request.BasicAuth(); !ok || username != "user" || password != "pass" {
+		t.Errorf("expected basic auth user:pass, got %q:%q", username, password)
+	}
+}
+
+func TestWithEndpoints(t *testing.T) {
+	paid, free := testutil.NewServer(t), testutil.NewServer(t)
+	paid.Result("eth_blockNumber", "0x1")
+	free.Result("eth_blockNumber", "0x1")
+	invoker := New(context.Background(), "http://unused", repositories.New(), WithEndpoints([]Endpoint{
+		{URL: paid.URL, Weight: 3},
+		{URL: free.URL, Weight: 1},
+	})).(*Invoker)
+
+	for i := 0; i < 400; i++ {
+		if _, err := invoker.CurrentBlock(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if paid.Count("eth_blockNumber") != 300 || free.Count("eth_blockNumber") != 100 {
+		t.Errorf("expected 300 and 100 calls, got %d and %d", paid.Count("eth_blockNumber"), free.Count("eth_blockNumber"))
+	}
+
+	// the calls of an unreachable endpoint fail over, then skip it
+	paid.Close()
+	for i := 0; i < 10; i++ {
+		if _, err := invoker.CurrentBlock(); err != nil {
+			t.Fatalf("expected the call to fail over, got %v", err)
+		}
+	}
+	if n := free.Count("eth_blockNumber"); n != 110 {
+		t.Errorf("expected the 10 calls on the healthy endpoint, got %d", n-100)
+	}
+}
+
+func TestWithEndpoints_nonIdempotent(t *testing.T) {
+	down, up := testutil.NewServer(t), testutil.NewServer(t)
+	up.Result("eth_sendRawTransaction", "0xaa")
+	up.Result("eth_blockNumber", "0x1")
+	down.Close()
+	newInvoker := func() *Invoker {
+		return New(context.Background(), "http://unused", repositories.New(), WithEndpoints([]Endpoint{
+			{URL: down.URL, Weight: 1},
+			{URL: up.URL, Weight: 1},
+		})).(*Invoker)
+	}
+
+	// a transaction the node may have received is not sent again
+	if _, err := newInvoker().SendRawTransaction("0xf86b"); err == nil {
+		t.Error("expected the transaction to fail on the unreachable endpoint")
+	}
+	up.AssertNotCalled("eth_sendRawTransaction")
+	if err := newInvoker().BatchCall(context.Background(), []BatchElem{
+		{Method: "eth_blockNumber", Result: new(string)},
+		{Method: "eth_sendRawTransaction", Params: []string{"0xf86b"}, Result: new(string)},
+	}); err == nil {
+		t.Error("expected the batch to fail on the unreachable endpoint")
+	}
+	up.AssertNotCalled("eth_sendRawTransaction")
+	if _, err := newInvoker().CurrentBlock(); err != nil {
+		t.Errorf("expected an idempotent call to fail over, got %v", err)
+	}
+}
+
+func TestWithReceipts(t *testing.T) {
+	rpc := testutil.NewServer(t)
+	var current atomic.Int64
+	current.Store(10)
+	rpc.Handle("eth_blockNumber", func([]json.RawMessage) interface{} { return fmt.Sprintf("%#x", current.Load()) })
+	rpc.Handle("eth_getBlockByNumber", func(params []json.RawMessage) interface{} {
+		var number string
+		json.Unmarshal(params[0], &number)
+		return map[string]interface{}{
+			"number":       number,
+			"transactions": []map[string]string{{"hash": "0xaa" + number[2:], "from": testAddress, "to": "0xdef"}},
+		}
+	})
+	rpc.Handle("eth_getBlockReceipts", func(params []json.RawMessage) interface{} {
+		var number string
+		json.Unmarshal(params[0], &number)
+		return []map[string]string{{"transactionHash": "0xaa" + number[2:], "status": "0x1"}}
+	})
+
+	ctx := context.Background()
+	invoker := New(ctx, rpc.URL, repositories.New(), WithReceipts()).(*Invoker)
+	notifications, release := invoker.Watch(testAddress)
+	defer release()
+
+	if err := invoker.subscribe(ctx, testAddress); err != nil {
+		t.Fatal(err)
+	}
+	if n := <-notifications; n.Receipt == nil || n.Receipt.Status != "0x1" {
+		t.Errorf("expected the block receipt, got %+v", n.Receipt)
+	}
+
+	// nodes lacking eth_getBlockReceipts are asked for each receipt
+	rpc.Fail("eth_getBlockReceipts", -32601, "the method eth_getBlockReceipts does not exist/is not available")
+	rpc.Handle("eth_getTransactionReceipt", func(params []json.RawMessage) interface{} {
+		var hash string
+		json.Unmarshal(params[0], &hash)
+		return map[string]string{"transactionHash": hash, "status": "0x0"}
+	})
+	if _, err := invoker.GetBlockReceipts(Latest); !errors.Is(err, ErrMethodNotSupported) {
+		t.Errorf("expected ErrMethodNotSupported, got %v", err)
+	}
+	current.Store(11)
+	if err := invoker.subscribe(ctx, testAddress); err != nil {
+		t.Fatal(err)
+	}
+	if n := <-notifications; n.Receipt == nil || n.Receipt.Status != "0x0" {
+		t.Errorf("expected the transaction receipt, got %+v", n.Receipt)
+	}
+	rpc.AssertCalled("eth_getTransactionReceipt", "0xaab")
+}
+
+func TestWithMaxConcurrentSubscriptions(t *testing.T) {
+	rpc := testutil.NewServer(t)
+	rpc.Result("eth_blockNumber", "0xa")
+	var inFlight, peak atomic.Int64
+	rpc.Handle("eth_getBlockByNumber", func(params []json.RawMessage) interface{} {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		time.Sleep(5 * time.Millisecond)
+		return blockByNumber(params)
+	})
+
+	ctx := context.Background()
+	repo := repositories.New()
+	invoker := New(ctx, rpc.URL, repo, WithMaxConcurrentSubscriptions(2)).(*Invoker)
+	defer invoker.Close()
+	var addresses []string
+	for i := 0; i < 6; i++ {
+		address := fmt.Sprintf("0x%040x", i+1)
+		addresses = append(addresses, address)
+		invoker.SubscribeFromBlock(address, 1+i)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for _, address := range addresses {
+		for {
+			if info, err := repo.GetBlockInfo(ctx, address); err == nil && info.LastProcessedBlock == 10 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %s to be backfilled", address)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if p := peak.Load(); p > 2 {
+		t.Errorf("expected at most 2 concurrent scans, got %d", p)
+	}
+}
+
+func TestSubscribeWhen(t *testing.T) {
+	rpc := testutil.NewServer(t)
+	var current atomic.Int64
+	current.Store(10)
+	rpc.Handle("eth_blockNumber", func([]json.RawMessage) interface{} { return fmt.Sprintf("%#x", current.Add(1)) })
+	rpc.Handle("eth_getBlockByNumber", func(params []json.RawMessage) interface{} {
+		var number string
+		json.Unmarshal(params[0], &number)
+		return map[string]interface{}{
+			"number":       number,
+			"transactions": []map[string]string{{"hash": "0xaa" + number[2:], "from": testAddress, "to": "0xdef"}},
+		}
+	})
+
+	ctx := context.Background()
+	repo := repositories.New()
+	invoker := New(ctx, rpc.URL, repo, WithInterval(time.Millisecond)).(*Invoker)
+	defer invoker.Close()
+	var fired atomic.Int64
+	var countWhenFired atomic.Int64
+	ok := invoker.SubscribeWhen(testAddress, func(info *models.BlockInfo) bool {
+		return info.Count >= 3
+	}, func() {
+		fired.Add(1)
+		info, _ := repo.GetBlockInfo(ctx, testAddress)
+		countWhenFired.Store(int64(info.Count))
+	})
+	if !ok {
+		t.Fatal("expected the address to be subscribed")
+	}
+	// a panicking predicate is logged, never firing
+	other := "0x00000000000000000000000000000000000000cd"
+	invoker.SubscribeWhen(other, func(*models.BlockInfo) bool { panic("boom") }, func() {
+		t.Error("expected the callback of a panicking predicate not to fire")
+	})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if info, err := repo.GetBlockInfo(ctx, testAddress); err == nil && info.Count >= 6 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected 6 transactions to be recorded")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if n := fired.Load(); n != 1 {
+		t.Errorf("expected the callback to fire once, got %d", n)
+	}
+	if n := countWhenFired.Load(); n != 3 {
+		t.Errorf("expected the callback to fire at 3 transactions, got %d", n)
+	}
+}
+
+func TestGetLogsChunked(t *testing.T) {
+	rpc := testutil.NewServer(t)
+	rpc.Handle("eth_getLogs", func(params []json.RawMessage) interface{} {
+		var filter struct {
+			FromBlock string `json:"fromBlock"`
+			ToBlock   string `json:"toBlock"`
+		}
+		json.Unmarshal(params[0], &filter)
+		from, _ := BlockTag(filter.FromBlock).Number()
+		to, _ := BlockTag(filter.ToBlock).Number()
+		if to-from+1 > 4 {
+			return &testutil.Error{Code: -32005, Message: "query returned more than 10000 results"}
+		}
+		var logs []map[string]string
+		for number := from; number <= to; number++ {
+			logs = append(logs, map[string]string{"blockNumber": fmt.Sprintf("%#x", number)})
+		}
+		return logs
+	})
+	invoker := New(context.Background(), rpc.URL, repositories.New()).(*Invoker)
+
+	logs, err := invoker.GetLogsChunked(LogFilter{FromBlock: 100, ToBlock: 119}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 20 {
+		t.Fatalf("expected a log per block, got %d", len(logs))
+	}
+	for i, log := range logs {
+		if expected := fmt.Sprintf("%#x", 100+i); log.BlockNumber != expected {
+			t.Fatalf("expected the logs in block order, got %s at %d", log.BlockNumber, i)
+		}
+	}
+	// each chunk of 10 is refused, then its halves of 5, then split in 3 and 2
+	if n := rpc.Count("eth_getLogs"); n != 2*(1+2+4) {
+		t.Errorf("expected 14 calls, got %d", n)
+	}
+	rpc.AssertCalled("eth_getLogs", map[string]string{"fromBlock": "0x64", "toBlock": "0x66"})
+
+	// other failures are not retried
+	rpc.Fail("eth_getLogs", -32000, "header not found")
+	if _, err := invoker.GetLogsChunked(LogFilter{FromBlock: 0, ToBlock: 9}, 0); err == nil || tooManyResults(err) {
+		t.Errorf("expected the failure, got %v", err)
+	}
+	if _, err := invoker.GetLogsChunked(LogFilter{FromBlock: 9, ToBlock: 0}, 5); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("expected ErrInvalidQuery, got %v", err)
+	}
+}
+
+func TestAdaptiveInterval(t *testing.T) {
+	a := newAdaptiveInterval(time.Second, 20*time.Second)
+	now := time.Now()
+	if _, ok := a.observe(100, now); ok {
+		t.Fatal("expected no interval before a block time is measured")
+	}
+
+	// polled every 5s on a 12s chain
+	height := 100
+	var interval time.Duration
+	for elapsed := 5 * time.Second; elapsed <= 10*time.Minute; elapsed += 5 * time.Second {
+		if mined := 100 + int(elapsed/(12*time.Second)); mined > height {
+			height = mined
+		}
+		interval, _ = a.observe(height, now.Add(elapsed))
+	}
+	if interval < 11*time.Second || interval > 13*time.Second {
+		t.Errorf("expected the interval to converge to 12s, got %s", interval)
+	}
+
+	// several blocks per poll measure a faster chain, bounded by min
+	for i := 1; i <= 30; i++ {
+		interval, _ = a.observe(height+10*i, now.Add(10*time.Minute+time.Duration(i)*5*time.Second))
+	}
+	if interval != time.Second {
+		t.Errorf("expected the interval bounded by 1s, got %s", interval)
+	}
+
+	invoker := New(context.Background(), "http://unused", repositories.New(), WithAdaptivePolling(0, time.Millisecond)).(*Invoker)
+	if invoker.adaptive.min != MinInterval || invoker.adaptive.max != MinInterval {
+		t.Errorf("expected the bounds raised to MinInterval, got %s and %s", invoker.adaptive.min, invoker.adaptive.max)
+	}
+}
+
+func TestBlockTransactionCount(t *testing.T) {
+	const hash = "0x1d59ff54b1eb26b013ce3cb5fc9dab3705b415a67127a003c3e61eb445bb8df2"
+	rpc := testutil.NewServer(t)
+	rpc.Result("eth_getBlockTransactionCountByNumber", "0x9a")
+	rpc.Result("eth_getBlockTransactionCountByHash", "0x3")
+	invoker := New(context.Background(), rpc.URL, repositories.New()).(*Invoker)
+
+	if count, err := invoker.BlockTransactionCount(BlockNumberTag(100)); err != nil || count != 154 {
+		t.Errorf("expected 154 transactions, got %d, %v", count, err)
+	}
+	rpc.AssertCalled("eth_getBlockTransactionCountByNumber", "0x64")
+	if count, err := invoker.BlockTransactionCount(BlockTag(hash)); err != nil || count != 3 {
+		t.Errorf("expected 3 transactions, got %d, %v", count, err)
+	}
+	rpc.AssertCalled("eth_getBlockTransactionCountByHash", hash)
+
+	if _, err := invoker.BlockTransactionCount("safe-ish"); !errors.Is(err, ErrInvalidBlockTag) {
+		t.Errorf("expected ErrInvalidBlockTag, got %v", err)
+	}
+	rpc.Result("eth_getBlockTransactionCountByNumber", nil)
+	if _, err := invoker.BlockTransactionCount(Latest); !errors.Is(err, ErrBlockNotFound) {
+		t.Errorf("expected ErrBlockNotFound, got %v", err)
+	}
+	rpc.Result("eth_getBlockTransactionCountByNumber", "many")
+	if _, err := invoker.BlockTransactionCount(Latest); !errors.Is(err, ErrUnexpectedResponse) {
+		t.Errorf("expected ErrUnexpectedResponse, got %v", err)
+	}
+}
+
+func TestSubscribeE(t *testing.T) {
+	rpc := testutil.NewServer(t)
+	rpc.Handle("eth_blockNumber", func([]json.RawMessage) interface{} {
+		return &testutil.Error{Code: -32000, Message: "header not found"}
+	})
+
+	invoker := New(context.Background(), rpc.URL, repositories.New(), WithInterval(time.Millisecond)).(*Invoker)
+	defer invoker.Close()
+
+	if _, err := invoker.SubscribeE(context.Background(), "0xnope"); !errors.Is(err, ErrInvalidAddress) {
+		t.Errorf("expected ErrInvalidAddress, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs, err := invoker.SubscribeE(ctx, testAddress)
+	if err != nil {
+		t.Fatalf("expected the address to be subscribed, got %v", err)
+	}
+	if _, err := invoker.SubscribeE(ctx, testAddress); !errors.Is(err, ErrAlreadySubscribed) {
+		t.Errorf("expected ErrAlreadySubscribed, got %v", err)
+	}
+	if !invoker.Subscribe(testAddress) {
+		t.Error("expected Subscribe to accept an address already subscribed")
+	}
+
+	select {
+	case err := <-errs:
+		var rpcErr *RPCError
+		if !errors.As(err, &rpcErr) || rpcErr.Code != -32000 {
+			t.Errorf("expected the RPC error of the poll, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a poll failure on the channel")
+	}
+
+	cancel()
+	deadline := time.After(2 * time.Second)
+	for {
+		select {
+		case _, ok := <-errs:
+			if ok {
+				continue
+			}
+		case <-deadline:
+			t.Fatal("expected the channel to close once ctx is done")
+		}
+		break
+	}
+	if invoker.Unsubscribe(testAddress) {
+		t.Error("expected the subscription to end with its context")
+	}
+}
+
+func TestSend(t *testing.T) {
+	rpc := testutil.NewServer(t)
+	rpc.Result("eth_blockNumber", "0x10")
+	rpc.Result("eth_getBlockByNumber", nil)
+	rpc.Fail("eth_getTransactionByHash", -32000, "header not found")
+	ctx := context.Background()
+	invoker := New(ctx, rpc.URL, repositories.New()).(*Invoker)
+
+	var number BlockNumber
+	if err := send(ctx, invoker, "eth_blockNumber", []interface{}{}, &number); err != nil {
+		t.Fatal(err)
+	}
+	if number.Result != "0x10" || number.JSONRPC != "2.0" || number.ID == 0 || number.Error != nil {
+		t.Errorf("unexpected response %+v", number)
+	}
+
+	var block FullBlockResult
+	if err := send(ctx, invoker, "eth_getBlockByNumber", []interface{}{"0x1", true}, &block); err != nil {
+		t.Fatal(err)
+	}
+	if block.Result != nil {
+		t.Errorf("expected a nil block, got %+v", block.Result)
+	}
+
+	var failed TransactionResult
+	err := send(ctx, invoker, "eth_getTransactionByHash", []string{"0xaa"}, &failed)
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != -32000 || failed.Result != nil {
+		t.Errorf("expected the error object, got %v and %+v", err, failed)
+	}
+	if !errors.Is(err, ErrUnexpectedResponse) {
+		t.Error("expected the error object to wrap ErrUnexpectedResponse")
+	}
+
+	// the response to another request is rejected
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"jsonrpc": "2.0", "id": -1, "result": "0x10"}`)
+	}))
+	defer other.Close()
+	err = send(ctx, New(ctx, other.URL, repositories.New()).(*Invoker), "eth_blockNumber", []interface{}{}, &number)
+	if !errors.Is(err, ErrUnexpectedResponse) {
+		t.Errorf("expected ErrUnexpectedResponse for another id, got %v", err)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	rpc := testutil.NewServer(t)
+	var current atomic.Int64
+	current.Store(10)
+	rpc.Handle("eth_blockNumber", func([]json.RawMessage) interface{} { return fmt.Sprintf("%#x", current.Add(1)) })
+	rpc.Handle("eth_getBlockByNumber", func(params []json.RawMessage) interface{} {
+		var number string
+		json.Unmarshal(params[0], &number)
+		return map[string]interface{}{
+			"number":       number,
+			"transactions": []map[string]string{{"hash": "0xaa" + number[2:], "from": testAddress, "to": "0xdef"}},
+		}
+	})
+
+	invoker := New(context.Background(), rpc.URL, repositories.New(), WithInterval(time.Millisecond)).(*Invoker)
+	defer invoker.Close()
+	if status := invoker.Status(); status.CurrentBlock != 0 || status.LastRPCSuccessAt != nil || status.LastError != "" {
+		t.Errorf("expected an empty status before any call, got %+v", status)
+	}
+	invoker.Subscribe(testAddress)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for invoker.Status().TransactionsRecorded < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected 2 transactions to be recorded")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	status := invoker.Status()
+	if status.CurrentBlock <= 10 || status.ActiveSubscriptions != 1 || status.LastRPCSuccessAt == nil || status.LastError != "" {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	invoker.Unsubscribe(testAddress)
+	rpc.Fail("eth_blockNumber", -32000, "header not found")
+	if _, err := invoker.CurrentBlock(); err == nil {
+		t.Fatal("expected the call to fail")
+	}
+	status = invoker.Status()
+	if status.ActiveSubscriptions != 0 || !strings.Contains(status.LastError, "header not found") || status.LastErrorAt == nil {
+		t.Errorf("expected the failure in the status, got %+v", status)
+	}
+}
+
+func TestSubscribeFromBlock(t *testing.T) {
+	rpc := testutil.NewServer(t)
+	rpc.Result("eth_blockNumber", "0x100")
+	rpc.Handle("eth_getBlockByNumber", func(params []json.RawMessage) interface{} {
+		var number string
+		json.Unmarshal(params[0], &number)
+		return map[string]interface{}{
+			"number":       number,
+			"transactions": []map[string]string{{"hash": "0xaa" + number[2:], "from": testAddress, "to": "0xdef"}},
+		}
+	})
+	rpc.Handle("eth_getTransactionByHash", func(params []json.RawMessage) interface{} {
+		var hash string
+		json.Unmarshal(params[0], &hash)
+		return map[string]string{"hash": hash, "from": testAddress, "to": "0xdef"}
+	})
+
+	ctx := context.Background()
+	repo := repositories.New()
+	invoker := New(ctx, rpc.URL, repo, WithInterval(time.Hour)).(*Invoker)
+	defer invoker.Close()
+	if !invoker.SubscribeFromBlock(testAddress, 0x10) {
+		t.Fatal("expected the address to be subscribed")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if info, err := repo.GetBlockInfo(ctx, testAddress); err == nil && info.LastProcessedBlock == 0x100 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected blocks 0x10 to 0x100 to be backfilled")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	calls := rpc.Calls("eth_getBlockByNumber")
+	if len(calls) != 0x100-0x10+1 {
+		t.Errorf("expected each block to be fetched once, got %d calls", len(calls))
+	}
+	for _, call := range calls {
+		if !call.Batch {
+			t.Fatal("expected the blocks to be fetched in batches")
+		}
+	}
+
+	transactions, err := invoker.Transactions(testAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transactions) != 0x100-0x10+1 || transactions[0].Hash != "0xaa10" || transactions[len(transactions)-1].Hash != "0xaa100" {
+		t.Errorf("expected the transactions of blocks 0x10 to 0x100 in order, got %d", len(transactions))
+	}
+	for _, call := range rpc.Calls("eth_getTransactionByHash") {
+		if !call.Batch {
+			t.Fatal("expected the transactions to be fetched in batches")
+		}
+	}
+}
+
+func TestBackfill_bounds(t *testing.T) {
+	rpc := testutil.NewServer(t)
+	rpc.Result("eth_blockNumber", "0x10")
+	rpc.Handle("eth_getBlockByNumber", blockByNumber)
+
+	ctx := context.Background()
+	repo := repositories.New()
+	invoker := New(ctx, rpc.URL, repo, WithMaxBackfillBlocks(4)).(*Invoker)
+
+	// older blocks than the bound are skipped
+	if err := invoker.backfill(ctx, "0xabc", 1); err != nil {
+		t.Fatal(err)
+	}
+	rpc.AssertCalled("eth_getBlockByNumber", "0xd", true)
+	if n := rpc.Count("eth_getBlockByNumber"); n != 4 {
+		t.Errorf("expected 4 blocks to be scanned, got %d", n)
+	}
+	if info, _ := repo.GetBlockInfo(ctx, "0xabc"); info.LastProcessedBlock != 0x10 || info.Count != 4 {
+		t.Errorf("unexpected progress %+v", info)
+	}
+
+	// a start ahead of the tip waits for it
+	if err := invoker.backfill(ctx, "0xdef", 0x20); err != nil {
+		t.Fatal(err)
+	}
+	if n := rpc.Count("eth_getBlockByNumber"); n != 4 {
+		t.Errorf("expected no block to be scanned, got %d", n-4)
+	}
+	if info, _ := repo.GetBlockInfo(ctx, "0xdef"); info.LastProcessedBlock != 0x1f {
+		t.Errorf("expected the progress to wait for block 0x20, got %+v", info)
+	}
+
+	// a block not mined yet fails the backfill
+	rpc.Result("eth_blockNumber", "0x30")
+	rpc.Result("eth_getBlockByNumber", nil)
+	if err := invoker.backfill(ctx, "0x123", 0x30); !errors.Is(err, ErrBlockNotFound) {
+		t.Errorf("expected ErrBlockNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dungnh3/trustwallet-assignment/internal/repositories"
+	"github.com/dungnh3/trustwallet-assignment/internal/utils"
+)
+
+// TransactionQuery filters and paginates the transactions returned by
+// GetTransactionsFiltered. Zero fields do not filter.
+type TransactionQuery struct {
+	// Direction keeps only Incoming, Outgoing or Self transactions.
+	Direction Direction
+	// Limit is the maximum number of transactions returned.
+	Limit int
+	// Offset skips the first transactions. It cannot be combined with Cursor.
+	Offset int
+	// Cursor resumes after the page ending with TransactionPage.NextCursor.
+	Cursor int
+	// Since and Until bound when the transactions were recorded; Since is
+	// inclusive, Until exclusive.
+	Since time.Time
+	Until time.Time
+}
+
+// TransactionPage is a page of transactions. NextCursor, when not zero, is
+// the Cursor of the next page.
+type TransactionPage struct {
+	Transactions []Transaction
+	NextCursor   int
+}
+
+// Validate reports options out of range or contradicting each other.
+func (q TransactionQuery) Validate() error {
+	switch q.Direction {
+	case "", Incoming, Outgoing, Self:
+	default:
+		return fmt.Errorf("%w: unknown direction %q", ErrInvalidQuery, q.Direction)
+	}
+	if q.Limit < 0 || q.Offset < 0 || q.Cursor < 0 {
+		return fmt.Errorf("%w: limit, offset and cursor must not be negative", ErrInvalidQuery)
+	}
+	if q.Offset > 0 && q.Cursor > 0 {
+		return fmt.Errorf("%w: offset and cursor are exclusive", ErrInvalidQuery)
+	}
+	if !q.Since.IsZero() && !q.Until.IsZero() && !q.Since.Before(q.Until) {
+		return fmt.Errorf("%w: since must be before until", ErrInvalidQuery)
+	}
+	return nil
+}
+
+// GetTransactionsFiltered returns the page of transactions recorded for a
+// subscribed address matching q. Transactions returns them all.
+func (s *Invoker) GetTransactionsFiltered(address string, q TransactionQuery) (*TransactionPage, error) {
+	return s.GetTransactionsFilteredContext(s.ctx, address, q)
+}
+
+// GetTransactionsFilteredContext is GetTransactionsFiltered calling the node
+// with ctx.
+func (s *Invoker) GetTransactionsFilteredContext(ctx context.Context, address string, q TransactionQuery) (*TransactionPage, error) {
+	address = utils.NormalizeAddress(address)
+	if !utils.IsHexAddress(address) {
+		return nil, fmt.Errorf("%q: %w", address, ErrInvalidAddress)
+	}
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	blockTransactions, err := s.repo.ListBlockTransactions(ctx, repositories.TransactionFilter{
+		BlockAddress: address,
+		Direction:    string(q.Direction),
+		Since:        q.Since,
+		Until:        q.Until,
+		AfterID:      q.Cursor,
+		Offset:       q.Offset,
+		Limit:        q.Limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("load transactions of %s: %w", address, err)
+	}
+	transactions, err := s.fetchTransactions(ctx, blockTransactions)
+	if err != nil {
+		return nil, err
+	}
+	page := &TransactionPage{Transactions: transactions}
+	if q.Limit > 0 && len(blockTransactions) == q.Limit {
+		page.NextCursor = blockTransactions[len(blockTransactions)-1].ID
+	}
+	return page, nil
+}
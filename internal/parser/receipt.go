@@ -0,0 +1,165 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dungnh3/trustwallet-assignment/internal/utils"
+	"go.uber.org/zap"
+)
+
+// ErrReceiptNotFound is returned when the node has no receipt for a
+// transaction, e.g. while it is pending.
+var ErrReceiptNotFound = errors.New("receipt not found")
+
+// Log is an event emitted by a contract during a transaction.
+type Log struct {
+	Address string `json:"address"`
+	// Topics holds the event topic first, then the indexed arguments.
+	Topics           []string `json:"topics"`
+	Data             string   `json:"data"`
+	BlockNumber      string   `json:"blockNumber"`
+	TransactionHash  string   `json:"transactionHash"`
+	TransactionIndex string   `json:"transactionIndex"`
+	BlockHash        string   `json:"blockHash"`
+	LogIndex         string   `json:"logIndex"`
+	Removed          bool     `json:"removed"`
+}
+
+// Receipt is the outcome of a mined transaction.
+type Receipt struct {
+	TransactionHash   string `json:"transactionHash"`
+	TransactionIndex  string `json:"transactionIndex"`
+	BlockHash         string `json:"blockHash"`
+	BlockNumber       string `json:"blockNumber"`
+	From              string `json:"from"`
+	To                string `json:"to"`
+	ContractAddress   string `json:"contractAddress"`
+	CumulativeGasUsed string `json:"cumulativeGasUsed"`
+	GasUsed           string `json:"gasUsed"`
+	EffectiveGasPrice string `json:"effectiveGasPrice"`
+	// Status is "0x1" for success and "0x0" for failure.
+	Status string `json:"status"`
+	Logs   []Log  `json:"logs"`
+}
+
+// GetTransactionReceipt returns the receipt of the transaction hash, or
+// ErrReceiptNotFound when it is not mined yet.
+func (s *Invoker) GetTransactionReceipt(hash string) (*Receipt, error) {
+	return s.transactionReceipt(s.ctx, hash)
+}
+
+func (s *Invoker) transactionReceipt(ctx context.Context, hash string) (*Receipt, error) {
+	var receipt *Receipt
+	if err := s.Call(ctx, "eth_getTransactionReceipt", []string{hash}, &receipt); err != nil {
+		return nil, err
+	}
+	if receipt == nil {
+		return nil, fmt.Errorf("%s: %w", hash, ErrReceiptNotFound)
+	}
+	return receipt, nil
+}
+
+// GetBlockReceipts returns the receipts of every transaction of the block
+// blockTag in a single call, far cheaper than a GetTransactionReceipt per
+// transaction. Nodes lacking eth_getBlockReceipts fail with
+// ErrMethodNotSupported, for callers to fall back to GetTransactionReceipt.
+func (s *Invoker) GetBlockReceipts(blockTag BlockTag) ([]Receipt, error) {
+	return s.blockReceipts(s.ctx, blockTag)
+}
+
+func (s *Invoker) blockReceipts(ctx context.Context, blockTag BlockTag) ([]Receipt, error) {
+	if err := blockTag.Validate(); err != nil {
+		return nil, err
+	}
+	var receipts []Receipt
+	if err := s.Call(ctx, "eth_getBlockReceipts", []interface{}{blockTag}, &receipts); err != nil {
+		return nil, methodNotSupported(err)
+	}
+	if receipts == nil {
+		return nil, fmt.Errorf("block %s: %w", blockTag, ErrBlockNotFound)
+	}
+	return receipts, nil
+}
+
+// receiptsOf returns, by hash, the receipts of the transactions of block
+// related to one of addresses. They are fetched with a single
+// eth_getBlockReceipts, or one eth_getTransactionReceipt per transaction once
+// the node turned out to lack it.
+func (s *Invoker) receiptsOf(ctx context.Context, number int, block *FullBlockResult, addresses []string) (map[string]*Receipt, error) {
+	var related []Transaction
+	for _, trans := range block.Result.Transactions {
+		for _, address := range addresses {
+			if trans.Direction(address) != Unrelated {
+				related = append(related, trans)
+				break
+			}
+		}
+	}
+	receipts := make(map[string]*Receipt, len(related))
+	if len(related) == 0 {
+		return receipts, nil
+	}
+
+	if !s.noBlockReceipts.Load() {
+		all, err := s.blockReceipts(ctx, BlockNumberTag(number))
+		switch {
+		case err == nil:
+			for i := range all {
+				receipts[all[i].TransactionHash] = &all[i]
+			}
+			return receipts, nil
+		case errors.Is(err, ErrMethodNotSupported):
+			s.logger.Info("eth_getBlockReceipts is not supported, fetching receipts one by one", zap.Error(err))
+			s.noBlockReceipts.Store(true)
+		default:
+			return nil, err
+		}
+	}
+	for _, trans := range related {
+		receipt, err := s.transactionReceipt(ctx, trans.Hash)
+		if err != nil {
+			return nil, err
+		}
+		receipts[trans.Hash] = receipt
+	}
+	return receipts, nil
+}
+
+// FilterLogs returns the logs of the event eventSig, such as
+// "Transfer(address,address,uint256)", and, unless addr is empty, having addr
+// as one of their indexed arguments.
+func FilterLogs(logs []Log, eventSig string, addr string) []Log {
+	topic := utils.EventTopic(eventSig)
+	var addrTopic string
+	if addr != "" {
+		addrTopic = addressTopic(addr)
+	}
+	var out []Log
+	for _, log := range logs {
+		if len(log.Topics) == 0 || !strings.EqualFold(log.Topics[0], topic) {
+			continue
+		}
+		if addrTopic == "" || hasTopic(log.Topics[1:], addrTopic) {
+			out = append(out, log)
+		}
+	}
+	return out
+}
+
+// addressTopic returns addr left-padded to 32 bytes, as indexed in topics.
+func addressTopic(addr string) string {
+	hexAddr := strings.TrimPrefix(utils.NormalizeAddress(addr), "0x")
+	return "0x" + strings.Repeat("0", max(64-len(hexAddr), 0)) + hexAddr
+}
+
+func hasTopic(topics []string, topic string) bool {
+	for _, t := range topics {
+		if strings.EqualFold(t, topic) {
+			return true
+		}
+	}
+	return false
+}
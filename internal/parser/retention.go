@@ -0,0 +1,41 @@
+package parser
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// startRetention deletes, every interval until Close, the transactions
+// recorded more than maxAge ago.
+func (s *Invoker) startRetention(maxAge, interval time.Duration) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.stopRetention = cancel
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.prune(ctx, maxAge)
+			}
+		}
+	}()
+}
+
+func (s *Invoker) prune(ctx context.Context, maxAge time.Duration) {
+	before := time.Now().UTC().Add(-maxAge)
+	deleted, err := s.repo.DeleteTransactionsBefore(ctx, before)
+	if err != nil {
+		s.logger.Error("failed to prune transactions", zap.Time("before", before), zap.Error(err))
+		return
+	}
+	if deleted > 0 {
+		s.logger.Info("pruned transactions", zap.Time("before", before), zap.Int("deleted", deleted))
+	}
+}
@@ -0,0 +1,52 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dungnh3/trustwallet-assignment/internal/utils"
+)
+
+var (
+	// ErrInvalidTransaction is returned before any RPC call when a signed
+	// transaction is not 0x-prefixed hex.
+	ErrInvalidTransaction = errors.New("invalid signed transaction")
+
+	// ErrNonceTooLow, ErrInsufficientFunds and ErrUnderpriced are wrapped in
+	// the errors of SendRawTransaction when the node rejects a transaction
+	// for that reason, along with its *RPCError.
+	ErrNonceTooLow       = errors.New("nonce too low")
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrUnderpriced       = errors.New("transaction underpriced")
+)
+
+// SendRawTransaction submits a signed transaction and returns its hash. The
+// call is never retried nor failed over to another endpoint, since sending
+// it twice is not idempotent.
+func (s *Invoker) SendRawTransaction(signedTxHex string) (string, error) {
+	if !utils.IsHex(signedTxHex) || len(signedTxHex)%2 != 0 {
+		return "", ErrInvalidTransaction
+	}
+	var hash string
+	if err := s.Call(s.ctx, "eth_sendRawTransaction", []string{signedTxHex}, &hash); err != nil {
+		return "", rejectionOf(err)
+	}
+	return hash, nil
+}
+
+// rejectionOf wraps the reason of a rejected transaction in err, as reported
+// by geth and most other clients.
+func rejectionOf(err error) error {
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) {
+		return err
+	}
+	message := strings.ToLower(rpcErr.Message)
+	for _, reason := range []error{ErrNonceTooLow, ErrInsufficientFunds, ErrUnderpriced} {
+		if strings.Contains(message, reason.Error()) {
+			return &CallError{Method: "eth_sendRawTransaction", Err: fmt.Errorf("%w: %w", reason, rpcErr)}
+		}
+	}
+	return err
+}
@@ -0,0 +1,77 @@
+package parser
+
+import (
+	"sync"
+	"time"
+)
+
+// ParserStatus is a point-in-time snapshot of the parser health.
+type ParserStatus struct {
+	CurrentBlock         int        `json:"current_block"`
+	ActiveSubscriptions  int        `json:"active_subscriptions"`
+	LastRPCSuccessAt     *time.Time `json:"last_rpc_success_at,omitempty"`
+	LastError            string     `json:"last_error,omitempty"`
+	LastErrorAt          *time.Time `json:"last_error_at,omitempty"`
+	TransactionsRecorded int64      `json:"transactions_recorded"`
+}
+
+// stats holds the counters behind ParserStatus, updated as the parser runs.
+type stats struct {
+	mutex                sync.Mutex
+	currentBlock         int
+	lastRPCSuccessAt     time.Time
+	lastError            error
+	lastErrorAt          time.Time
+	transactionsRecorded int64
+}
+
+func (s *stats) rpcDone(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err != nil {
+		s.lastError = err
+		s.lastErrorAt = time.Now().UTC()
+		return
+	}
+	s.lastRPCSuccessAt = time.Now().UTC()
+}
+
+func (s *stats) setCurrentBlock(number int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.currentBlock = number
+}
+
+func (s *stats) addTransactions(n int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.transactionsRecorded += int64(n)
+}
+
+func (s *stats) snapshot() ParserStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	status := ParserStatus{
+		CurrentBlock:         s.currentBlock,
+		TransactionsRecorded: s.transactionsRecorded,
+	}
+	if !s.lastRPCSuccessAt.IsZero() {
+		at := s.lastRPCSuccessAt
+		status.LastRPCSuccessAt = &at
+	}
+	if s.lastError != nil {
+		at := s.lastErrorAt
+		status.LastError = s.lastError.Error()
+		status.LastErrorAt = &at
+	}
+	return status
+}
+
+// Status returns a snapshot of the parser health.
+func (s *Invoker) Status() ParserStatus {
+	status := s.stats.snapshot()
+	s.mutex.Lock()
+	status.ActiveSubscriptions = len(s.subscriptions)
+	s.mutex.Unlock()
+	return status
+}
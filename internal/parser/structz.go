@@ -1,17 +1,25 @@
 package parser
 
-type BlockNumber struct {
-	JsonRPC string `json:"jsonrpc"`
-	Result  string `json:"result"`
-	ID      int    `json:"id"`
-}
+import (
+	"bytes"
+	"encoding/json"
+)
 
-type CountBlockTransaction struct {
-	JsonRPC string `json:"jsonrpc"`
-	Result  string `json:"result"`
-	ID      int    `json:"id"`
+// RPCResponse is a JSON-RPC response whose result is a T. Error is nil
+// unless the call failed, in which case Result is the zero T.
+type RPCResponse[T any] struct {
+	JSONRPC string    `json:"jsonrpc"`
+	Result  T         `json:"result"`
+	Error   *RPCError `json:"error,omitempty"`
+	ID      int       `json:"id"`
 }
 
+type BlockNumber = RPCResponse[string]
+
+type ChainID = RPCResponse[string]
+
+type CountBlockTransaction = RPCResponse[string]
+
 type Transaction struct {
 	Type             string `json:"type"`
 	BlockHash        string `json:"blockHash"`
@@ -29,14 +37,58 @@ type Transaction struct {
 	S                string `json:"s"`
 	GasPrice         string `json:"gasPrice"`
 	ChainID          string `json:"chainId"`
+
+	// contractCreation is set when to is null rather than missing
+	contractCreation bool
+}
+
+// IsContractCreation reports whether t deploys a contract, which the node
+// sends with a null to; To is then empty. The address of the contract is the
+// ContractAddress of the receipt of t.
+func (t Transaction) IsContractCreation() bool {
+	return t.contractCreation
+}
+
+// UnmarshalJSON decodes a transaction, telling a null to, a contract
+// creation, from a missing one.
+func (t *Transaction) UnmarshalJSON(data []byte) error {
+	type plain Transaction
+	var raw struct {
+		plain
+		To json.RawMessage `json:"to"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*t = Transaction(raw.plain)
+	if bytes.Equal(raw.To, []byte("null")) {
+		t.contractCreation = true
+		return nil
+	}
+	if len(raw.To) > 0 {
+		return json.Unmarshal(raw.To, &t.To)
+	}
+	return nil
 }
 
-type TransactionResult struct {
-	JsonRPC string      `json:"jsonrpc"`
-	Result  Transaction `json:"result"`
-	ID      int         `json:"id"`
+// MarshalJSON encodes t with a null to for contract creations, as the node
+// does.
+func (t Transaction) MarshalJSON() ([]byte, error) {
+	type plain Transaction
+	out := struct {
+		plain
+		To *string `json:"to"`
+	}{plain: plain(t)}
+	if !t.contractCreation {
+		out.To = &t.To
+	}
+	return json.Marshal(out)
 }
 
+// TransactionResult holds a nil Result when the node does not know the
+// transaction.
+type TransactionResult = RPCResponse[*Transaction]
+
 type Block struct {
 	Difficulty       string   `json:"difficulty"`
 	ExtraData        string   `json:"extraData"`
@@ -60,8 +112,17 @@ type Block struct {
 	Uncles           []string `json:"uncles"`
 }
 
-type BlockResult struct {
-	JsonRPC string `json:"jsonrpc"`
-	Result  Block  `json:"result"`
-	ID      int    `json:"id"`
+// BlockResult holds a nil Result when the node does not know the block.
+type BlockResult = RPCResponse[*Block]
+
+// FullBlock is a block fetched with its full transaction objects.
+type FullBlock struct {
+	Hash         string        `json:"hash"`
+	Number       string        `json:"number"`
+	ParentHash   string        `json:"parentHash"`
+	Timestamp    string        `json:"timestamp"`
+	Transactions []Transaction `json:"transactions"`
 }
+
+// FullBlockResult holds a nil Result when the block is not mined yet.
+type FullBlockResult = RPCResponse[*FullBlock]
@@ -0,0 +1,586 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dungnh3/trustwallet-assignment/internal/models"
+	"github.com/dungnh3/trustwallet-assignment/internal/repositories"
+	"github.com/dungnh3/trustwallet-assignment/internal/utils"
+	"go.uber.org/zap"
+)
+
+// backfillLogEvery is the number of blocks between two backfill progress logs.
+const backfillLogEvery = 100
+
+// subscriptionErrorBuffer is the capacity of the channels of SubscribeE.
+const subscriptionErrorBuffer = 16
+
+// ErrAlreadySubscribed is returned by SubscribeE for an address already
+// subscribed.
+var ErrAlreadySubscribed = errors.New("already subscribed")
+
+// Subscribe starts recording the transactions of address found in blocks
+// mined from now on. Every subscribed address is polled by a single loop,
+// fetching each new block once. Failures are only logged, see SubscribeE.
+// Like every method taking an address, it does not tell its checksummed and
+// lowercase spellings apart.
+func (s *Invoker) Subscribe(address string) bool {
+	address = utils.NormalizeAddress(address)
+	_, err := s.startSubscription(s.ctx, address, nil, false)
+	return err == nil || errors.Is(err, ErrAlreadySubscribed)
+}
+
+// SubscribeE is Subscribe ending when ctx is done, and reporting why it could
+// not start, and then the failures of the polls of address, e.g. to alert on
+// them. The failures are sent on the returned channel, closed when the
+// subscription ends; they are dropped while its buffer is full, so that a
+// slow reader never holds back the poll loop. The polls go on after a
+// failure, retrying on the next interval.
+func (s *Invoker) SubscribeE(ctx context.Context, address string) (<-chan error, error) {
+	address = utils.NormalizeAddress(address)
+	sub, err := s.startSubscription(ctx, address, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	return sub.errs, nil
+}
+
+// SubscribeFromBlock records the transactions of address found from fromBlock
+// up to the current tip, then keeps polling like Subscribe. At most
+// WithMaxBackfillBlocks blocks are scanned; older blocks are skipped. When
+// fromBlock is ahead of the tip, recording starts once it is mined.
+func (s *Invoker) SubscribeFromBlock(address string, fromBlock int) bool {
+	address = utils.NormalizeAddress(address)
+	_, err := s.startSubscription(s.ctx, address, func(ctx context.Context) error {
+		return s.backfill(ctx, address, fromBlock)
+	}, false)
+	return err == nil || errors.Is(err, ErrAlreadySubscribed)
+}
+
+// subscription is an address polled by the shared poll loop.
+type subscription struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	// ready is set once the backfill of the address, if any, is done and
+	// the poll loop may scan it.
+	ready bool
+	// stopWatch stops ending the subscription with the context of
+	// SubscribeE, nil for the others
+	stopWatch func() bool
+
+	// errs receives the failures of the subscription, nil unless made by
+	// SubscribeE; it is closed once ended is set.
+	errsMutex sync.Mutex
+	errs      chan error
+	ended     bool
+}
+
+// report sends err on the channel of sub without blocking.
+func (sub *subscription) report(err error) {
+	sub.errsMutex.Lock()
+	defer sub.errsMutex.Unlock()
+	if sub.errs == nil || sub.ended || sub.ctx.Err() != nil {
+		return
+	}
+	select {
+	case sub.errs <- err:
+	default:
+	}
+}
+
+// end cancels sub and closes its channel.
+func (sub *subscription) end() {
+	sub.cancel()
+	if sub.stopWatch != nil {
+		sub.stopWatch()
+	}
+	sub.errsMutex.Lock()
+	defer sub.errsMutex.Unlock()
+	if !sub.ended && sub.errs != nil {
+		close(sub.errs)
+	}
+	sub.ended = true
+}
+
+// startSubscription subscribes address until ctx is done, running init
+// before it is polled unless nil. The subscription gets an error channel
+// when withErrors.
+func (s *Invoker) startSubscription(ctx context.Context, address string, init func(ctx context.Context) error, withErrors bool) (*subscription, error) {
+	if !utils.IsHexAddress(address) {
+		s.logger.Error("failed to subscribe", zap.String("address", address), zap.Error(ErrInvalidAddress))
+		return nil, fmt.Errorf("%q: %w", address, ErrInvalidAddress)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.subscriptions[address]; ok {
+		return nil, fmt.Errorf("%s: %w", address, ErrAlreadySubscribed)
+	}
+
+	subCtx, cancel := context.WithCancel(s.ctx)
+	sub := &subscription{ctx: subCtx, cancel: cancel, ready: init == nil}
+	if withErrors {
+		sub.errs = make(chan error, subscriptionErrorBuffer)
+	}
+	if ctx != s.ctx {
+		sub.stopWatch = context.AfterFunc(ctx, func() {
+			s.endSubscription(address, sub)
+		})
+	}
+	s.subscriptions[address] = sub
+	s.startPolling()
+	if sub.ready {
+		s.wakePoll()
+		return sub, nil
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if err := s.runScan(subCtx, init); err != nil {
+			s.logger.Error("failed to backfill", zap.String("address", address), zap.Error(err))
+			sub.report(err)
+		}
+		s.mutex.Lock()
+		sub.ready = true
+		s.mutex.Unlock()
+		s.wakePoll()
+	}()
+	return sub, nil
+}
+
+func (s *Invoker) Unsubscribe(address string) bool {
+	address = utils.NormalizeAddress(address)
+	s.mutex.Lock()
+	sub, ok := s.subscriptions[address]
+	s.mutex.Unlock()
+	return ok && s.endSubscription(address, sub)
+}
+
+// endSubscription ends sub, the subscription of address, unless it was
+// replaced or ended meanwhile.
+func (s *Invoker) endSubscription(address string, sub *subscription) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.subscriptions[address] != sub {
+		return false
+	}
+	sub.end()
+	delete(s.subscriptions, address)
+	s.forgetLastBlock(address)
+	s.disarm(address)
+	return true
+}
+
+// reportError sends err on the channel of the subscription of address, if
+// any.
+func (s *Invoker) reportError(address string, err error) {
+	s.mutex.Lock()
+	sub, ok := s.subscriptions[address]
+	s.mutex.Unlock()
+	if ok {
+		sub.report(err)
+	}
+}
+
+// Close stops every running subscription, the poll loop and the retention,
+// and waits for in-flight polls to finish.
+func (s *Invoker) Close() error {
+	s.mutex.Lock()
+	for address, sub := range s.subscriptions {
+		sub.end()
+		delete(s.subscriptions, address)
+	}
+	if s.stopPoll != nil {
+		s.stopPoll()
+		s.stopPoll = nil
+	}
+	s.mutex.Unlock()
+	if s.stopRetention != nil {
+		s.stopRetention()
+	}
+
+	s.wg.Wait()
+	return nil
+}
+
+// runScan runs scan once one of the slots of WithMaxConcurrentSubscriptions
+// is free, giving up when ctx is done first.
+func (s *Invoker) runScan(ctx context.Context, scan func(ctx context.Context) error) error {
+	if s.scans != nil {
+		if err := s.scans.Acquire(ctx, 1); err != nil {
+			return err
+		}
+		defer s.scans.Release(1)
+	}
+	subscriptionScansGauge.Inc()
+	defer subscriptionScansGauge.Dec()
+	return scan(ctx)
+}
+
+// startPolling starts the poll loop unless running, the caller holding the
+// mutex.
+func (s *Invoker) startPolling() {
+	if s.stopPoll != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.stopPoll = cancel
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-s.wake:
+			}
+			ticker.Stop()
+			if err := s.poll(ctx, s.readySubscriptions()); err != nil {
+				s.logger.Error("failed to poll", zap.Error(err), zap.String("cause", failureCause(err)))
+			}
+			ticker.Reset(time.Duration(s.interval.Load()))
+		}
+	}()
+}
+
+// wakePoll makes the poll loop poll without waiting for the interval, e.g.
+// for a new subscription to start from the current block.
+func (s *Invoker) wakePoll() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// readySubscriptions returns the contexts of the subscriptions to poll, by
+// address.
+func (s *Invoker) readySubscriptions() map[string]context.Context {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	subs := make(map[string]context.Context, len(s.subscriptions))
+	for address, sub := range s.subscriptions {
+		if sub.ready {
+			subs[address] = sub.ctx
+		}
+	}
+	return subs
+}
+
+// subscribe polls address alone.
+func (s *Invoker) subscribe(ctx context.Context, address string) error {
+	return s.poll(ctx, map[string]context.Context{address: ctx})
+}
+
+// poll scans the blocks mined since the last poll of each address of subs,
+// fetching every block once for all of them. Blocks at or below the last
+// processed one of an address, including those persisted before a restart,
+// are never scanned again for it. subs holds the context of the
+// subscription of each address; a failing address is skipped until the next
+// poll without holding back the others. See WithMaxBlocksPerTick.
+func (s *Invoker) poll(ctx context.Context, subs map[string]context.Context) error {
+	if len(subs) == 0 {
+		return nil
+	}
+	current, err := s.currentBlock(ctx)
+	if err != nil {
+		for address := range subs {
+			s.reportError(address, err)
+		}
+		return err
+	}
+	if s.adaptive != nil {
+		if interval, ok := s.adaptive.observe(current, time.Now()); ok {
+			s.interval.Store(int64(interval))
+		}
+	}
+
+	var errs []error
+	pending := make(map[string]*models.BlockInfo, len(subs))
+	from := current + 1
+	for address, subCtx := range subs {
+		blockInfo, err := s.progress(subCtx, address, current)
+		if err != nil {
+			s.reportError(address, err)
+			errs = append(errs, fmt.Errorf("%s: %w", address, err))
+			continue
+		}
+		if blockInfo != nil {
+			pending[address] = blockInfo
+			from = min(from, blockInfo.LastProcessedBlock+1)
+		}
+	}
+
+	to := current
+	if s.maxBlocksPerTick > 0 {
+		to = min(current, from+s.maxBlocksPerTick-1)
+	}
+	defer func() {
+		backlog := 0
+		for _, blockInfo := range pending {
+			backlog = max(backlog, current-blockInfo.LastProcessedBlock)
+		}
+		blockBacklogGauge.Set(float64(backlog))
+	}()
+	for number := from; number <= to && len(pending) > 0; number++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		block, err := s.GetBlockByNumber(ctx, BlockNumberTag(number))
+		if err == nil {
+			err = s.storeBlock(ctx, number, block)
+		}
+		var receipts map[string]*Receipt
+		if err == nil && s.withReceipts {
+			addresses := make([]string, 0, len(pending))
+			for address := range pending {
+				addresses = append(addresses, address)
+			}
+			receipts, err = s.receiptsOf(ctx, number, block, addresses)
+		}
+		if err != nil {
+			for address := range pending {
+				s.reportError(address, err)
+			}
+			return errors.Join(append(errs, err)...)
+		}
+		for address, blockInfo := range pending {
+			if blockInfo.LastProcessedBlock >= number {
+				continue
+			}
+			subCtx := subs[address]
+			if subCtx.Err() != nil {
+				// unsubscribed meanwhile
+				delete(pending, address)
+				continue
+			}
+			next, err := s.record(subCtx, blockInfo, number, block, receipts)
+			if err != nil {
+				s.reportError(address, err)
+				errs = append(errs, fmt.Errorf("%s: %w", address, err))
+				delete(pending, address)
+				continue
+			}
+			pending[address] = next
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// progress returns the progress of address when blocks up to current remain
+// to be scanned for it, or nil.
+func (s *Invoker) progress(ctx context.Context, address string, current int) (*models.BlockInfo, error) {
+	if last, ok := s.lastBlock(address); ok && current <= last {
+		return nil, nil
+	}
+
+	blockInfo, err := s.blockInfo(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	if blockInfo == nil {
+		// first poll, only blocks mined from now on are of interest
+		return &models.BlockInfo{
+			BlockAddress:       address,
+			LastProcessedBlock: current - 1,
+		}, nil
+	}
+	s.setLastBlock(address, blockInfo.LastProcessedBlock)
+	if current <= blockInfo.LastProcessedBlock {
+		return nil, nil
+	}
+	return blockInfo, nil
+}
+
+func (s *Invoker) backfill(ctx context.Context, address string, fromBlock int) error {
+	blockInfo, err := s.blockInfo(ctx, address)
+	if err != nil {
+		return err
+	}
+	if blockInfo == nil {
+		blockInfo = &models.BlockInfo{BlockAddress: address}
+	} else {
+		// never record the same block twice
+		fromBlock = max(fromBlock, blockInfo.LastProcessedBlock+1)
+	}
+
+	current, err := s.currentBlock(ctx)
+	if err != nil {
+		return err
+	}
+	if fromBlock > current {
+		s.logger.Info("backfill starts ahead of the tip, waiting for it",
+			zap.String("address", address), zap.Int("from_block", fromBlock), zap.Int("current_block", current))
+		blockInfo.LastProcessedBlock = fromBlock - 1
+		if err := s.repo.UpsertBlockInfo(ctx, blockInfo); err != nil {
+			return err
+		}
+		s.setLastBlock(address, blockInfo.LastProcessedBlock)
+		return nil
+	}
+	if oldest := current - s.maxBackfillBlocks + 1; fromBlock < oldest {
+		s.logger.Warn("backfill range is too large, skipping older blocks",
+			zap.String("address", address), zap.Int("from_block", fromBlock), zap.Int("oldest_block", oldest))
+		fromBlock = oldest
+	}
+
+	s.logger.Info("backfill started",
+		zap.String("address", address), zap.Int("from_block", fromBlock), zap.Int("to_block", current))
+	blockInfo.LastProcessedBlock = fromBlock - 1
+	err = s.scan(ctx, blockInfo, current, func(number int) {
+		backfillBlocksCounter.Inc()
+		if (number-fromBlock+1)%backfillLogEvery == 0 {
+			s.logger.Info("backfill in progress",
+				zap.String("address", address), zap.Int("block", number), zap.Int("remaining", current-number))
+		}
+	})
+	if err != nil {
+		return err
+	}
+	s.logger.Info("backfill done", zap.String("address", address), zap.Int("to_block", current))
+	return nil
+}
+
+// scan records the transactions of blockInfo.BlockAddress found in the
+// blocks after blockInfo.LastProcessedBlock up to and including toBlock.
+// Blocks are fetched in batches, a few at once, and recorded in order.
+// Progress is persisted after every block, and reported to onBlock if set.
+func (s *Invoker) scan(ctx context.Context, blockInfo *models.BlockInfo, toBlock int, onBlock func(number int)) error {
+	window := fetchConcurrency * blockBatchSize
+	for from := blockInfo.LastProcessedBlock + 1; from <= toBlock; from += window {
+		blocks, err := s.getBlocks(ctx, from, min(from+window-1, toBlock))
+		if err != nil {
+			return err
+		}
+		for i, block := range blocks {
+			if blockInfo, err = s.scanBlock(ctx, blockInfo, from+i, block); err != nil {
+				return err
+			}
+			if onBlock != nil {
+				onBlock(from + i)
+			}
+		}
+	}
+	return nil
+}
+
+// scanBlock records the transactions of blockInfo.BlockAddress found in
+// block, at number, and returns the new progress.
+func (s *Invoker) scanBlock(ctx context.Context, blockInfo *models.BlockInfo, number int, block *FullBlockResult) (*models.BlockInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := s.storeBlock(ctx, number, block); err != nil {
+		return nil, err
+	}
+	var receipts map[string]*Receipt
+	if s.withReceipts {
+		var err error
+		if receipts, err = s.receiptsOf(ctx, number, block, []string{blockInfo.BlockAddress}); err != nil {
+			return nil, err
+		}
+	}
+	return s.record(ctx, blockInfo, number, block, receipts)
+}
+
+// storeBlock persists the hash and parent of block, at number.
+func (s *Invoker) storeBlock(ctx context.Context, number int, block *FullBlockResult) error {
+	record := &models.BlockRecord{
+		Number:     number,
+		Hash:       block.Result.Hash,
+		ParentHash: block.Result.ParentHash,
+	}
+	if timestamp, err := utils.ParseHexBig(block.Result.Timestamp); err == nil {
+		record.Timestamp = time.Unix(timestamp.Int64(), 0).UTC()
+	}
+	return s.repo.UpsertBlock(ctx, record)
+}
+
+// record persists the transactions of blockInfo.BlockAddress found in block,
+// at number, along with the progress, and returns the new progress. Their
+// notifications carry their receipt when in receipts.
+func (s *Invoker) record(ctx context.Context, blockInfo *models.BlockInfo, number int, block *FullBlockResult, receipts map[string]*Receipt) (*models.BlockInfo, error) {
+	address := blockInfo.BlockAddress
+	var blockTransactions []*models.BlockTransaction
+	var notifications []Notification
+	next := *blockInfo
+	for _, trans := range block.Result.Transactions {
+		direction := trans.Direction(address)
+		if direction == Unrelated {
+			continue
+		}
+		blockTransactions = append(blockTransactions, &models.BlockTransaction{
+			BlockAddress:       address,
+			TransactionAddress: trans.Hash,
+			Direction:          string(direction),
+			CreatedAt:          time.Now().UTC(),
+		})
+		notifications = append(notifications, Notification{Address: address, Transaction: trans, Receipt: receipts[trans.Hash]})
+		next.Count++
+		next.LatestTransactionAddress = trans.Hash
+	}
+	next.LastProcessedBlock = number
+
+	// the transactions are stored along with the progress counting them,
+	// or neither is
+	err := s.repo.Transact(ctx, func(tx repositories.Repository) error {
+		if len(blockTransactions) > 0 {
+			if err := tx.CreateBlockTransactions(ctx, blockTransactions); err != nil {
+				return err
+			}
+		}
+		return tx.UpsertBlockInfo(ctx, &next)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.stats.addTransactions(len(blockTransactions))
+	s.setLastBlock(address, number)
+	for _, n := range notifications {
+		s.broadcaster.publish(ctx, n)
+	}
+	s.fireTrigger(address, &next)
+	return &next, nil
+}
+
+func (s *Invoker) blockInfo(ctx context.Context, address string) (*models.BlockInfo, error) {
+	blockInfo, err := s.repo.GetBlockInfo(ctx, address)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	copied := *blockInfo
+	return &copied, nil
+}
+
+func (s *Invoker) lastBlock(address string) (int, bool) {
+	s.lastBlocksMutex.Lock()
+	defer s.lastBlocksMutex.Unlock()
+	last, ok := s.lastBlocks[address]
+	return last, ok
+}
+
+// setLastBlock records that every block up to number is processed and
+// persisted for address.
+func (s *Invoker) setLastBlock(address string, number int) {
+	s.lastBlocksMutex.Lock()
+	defer s.lastBlocksMutex.Unlock()
+	s.lastBlocks[address] = number
+}
+
+func (s *Invoker) forgetLastBlock(address string) {
+	s.lastBlocksMutex.Lock()
+	defer s.lastBlocksMutex.Unlock()
+	delete(s.lastBlocks, address)
+}
@@ -0,0 +1,209 @@
+// Package testutil provides a mock JSON-RPC endpoint for the tests of the
+// parser, answering each method with canned results or errors.
+package testutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// Error is a JSON-RPC error object. A handler returning an *Error answers
+// with it instead of a result.
+type Error struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Handler returns the result of a call of its method with params, or an
+// *Error.
+type Handler func(params []json.RawMessage) interface{}
+
+// Call is a request received by a Server.
+type Call struct {
+	Method string
+	Params []json.RawMessage
+	// Header is the header of the HTTP request carrying the call.
+	Header http.Header
+	// Batch is set when the call was part of a batch request.
+	Batch bool
+}
+
+// Server is a JSON-RPC endpoint answering single and batch requests through
+// the handler of their method, and recording every call. Calls of a method
+// without handler fail the test.
+type Server struct {
+	*httptest.Server
+	t testing.TB
+
+	mutex    sync.Mutex
+	handlers map[string]Handler
+	calls    []Call
+}
+
+// NewServer starts a Server, closed when the test ends.
+func NewServer(t testing.TB) *Server {
+	s := &Server{
+		t:        t,
+		handlers: make(map[string]Handler),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Handle answers the calls of method with handler.
+func (s *Server) Handle(method string, handler Handler) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.handlers[method] = handler
+}
+
+// Result answers every call of method with result.
+func (s *Server) Result(method string, result interface{}) {
+	s.Handle(method, func([]json.RawMessage) interface{} { return result })
+}
+
+// Fail answers every call of method with the error code and message.
+func (s *Server) Fail(method string, code int, message string) {
+	s.Result(method, &Error{Code: code, Message: message})
+}
+
+// Calls returns the calls of method received so far, of every method when
+// method is empty.
+func (s *Server) Calls(method string) []Call {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var calls []Call
+	for _, call := range s.calls {
+		if method == "" || call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Count returns the number of calls of method received so far.
+func (s *Server) Count(method string) int {
+	return len(s.Calls(method))
+}
+
+// AssertCalled fails the test unless method was called with params, compared
+// as JSON.
+func (s *Server) AssertCalled(method string, params ...interface{}) {
+	s.t.Helper()
+	expected, err := json.Marshal(params)
+	if err != nil {
+		s.t.Fatalf("invalid params: %v", err)
+	}
+	calls := s.Calls(method)
+	for _, call := range calls {
+		actual, _ := json.Marshal(call.Params)
+		if jsonEqual(expected, actual) {
+			return
+		}
+	}
+	var received []string
+	for _, call := range calls {
+		actual, _ := json.Marshal(call.Params)
+		received = append(received, string(actual))
+	}
+	s.t.Errorf("expected a call of %s with %s, got %v", method, expected, received)
+}
+
+// AssertNotCalled fails the test if method was called.
+func (s *Server) AssertNotCalled(method string) {
+	s.t.Helper()
+	if n := s.Count(method); n > 0 {
+		s.t.Errorf("expected no call of %s, got %d", method, n)
+	}
+}
+
+type request struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	var body json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		s.t.Errorf("invalid request body: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		var reqs []request
+		if err := json.Unmarshal(body, &reqs); err != nil {
+			s.t.Errorf("invalid batch request: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resps := make([]response, 0, len(reqs))
+		for _, req := range reqs {
+			resps = append(resps, s.answer(req, r.Header, true))
+		}
+		json.NewEncoder(w).Encode(resps)
+		return
+	}
+	var req request
+	if err := json.Unmarshal(body, &req); err != nil {
+		s.t.Errorf("invalid request: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(s.answer(req, r.Header, false))
+}
+
+func (s *Server) answer(req request, header http.Header, batch bool) response {
+	s.mutex.Lock()
+	s.calls = append(s.calls, Call{Method: req.Method, Params: req.Params, Header: header.Clone(), Batch: batch})
+	handler, ok := s.handlers[req.Method]
+	s.mutex.Unlock()
+
+	resp := response{JSONRPC: "2.0", ID: req.ID}
+	if !ok {
+		s.t.Errorf("unexpected method %s", req.Method)
+		resp.Error = &Error{Code: -32601, Message: "method not found"}
+		return resp
+	}
+	result := handler(req.Params)
+	if rpcErr, ok := result.(*Error); ok {
+		resp.Error = rpcErr
+		return resp
+	}
+	// a nil result is sent as null rather than omitted
+	if result == nil {
+		result = json.RawMessage("null")
+	}
+	resp.Result = result
+	return resp
+}
+
+// jsonEqual reports whether a and b encode the same value.
+func jsonEqual(a, b []byte) bool {
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	ra, _ := json.Marshal(va)
+	rb, _ := json.Marshal(vb)
+	return bytes.Equal(ra, rb)
+}
@@ -0,0 +1,101 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/dungnh3/trustwallet-assignment/internal/utils"
+)
+
+// selectors of the ERC20 metadata functions
+const (
+	nameSelector     = "0x06fdde03"
+	symbolSelector   = "0x95d89b41"
+	decimalsSelector = "0x313ce567"
+)
+
+// TokenInfo is the metadata of an ERC20 token.
+type TokenInfo struct {
+	Contract string `json:"contract"`
+	// Name and Symbol are empty when the token does not implement them.
+	Name     string `json:"name"`
+	Symbol   string `json:"symbol"`
+	Decimals int    `json:"decimals"`
+}
+
+// tokenCache holds the metadata of the tokens already fetched, which never
+// changes.
+type tokenCache struct {
+	mutex  sync.RWMutex
+	tokens map[string]TokenInfo
+}
+
+func (c *tokenCache) get(contract string) (TokenInfo, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	info, ok := c.tokens[contract]
+	return info, ok
+}
+
+func (c *tokenCache) put(info TokenInfo) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.tokens == nil {
+		c.tokens = make(map[string]TokenInfo)
+	}
+	c.tokens[info.Contract] = info
+}
+
+// TokenInfo returns the name, symbol and decimals of the ERC20 token at
+// contract. Results are cached for the lifetime of the Invoker.
+func (s *Invoker) TokenInfo(contract string) (TokenInfo, error) {
+	if !utils.IsHexAddress(contract) {
+		return TokenInfo{}, fmt.Errorf("%q: %w", contract, ErrInvalidAddress)
+	}
+	contract = utils.NormalizeAddress(contract)
+	if info, ok := s.tokens.get(contract); ok {
+		return info, nil
+	}
+
+	info := TokenInfo{Contract: contract}
+	result, err := s.EthCall(contract, decimalsSelector, Latest)
+	if err != nil {
+		return TokenInfo{}, err
+	}
+	decimals, err := DecodeUint256(result)
+	if err != nil || !decimals.IsInt64() || decimals.Int64() > 255 {
+		return TokenInfo{}, fmt.Errorf("decimals of %s: %w: %s", contract, ErrUnexpectedResponse, result)
+	}
+	info.Decimals = int(decimals.Int64())
+	if info.Name, err = s.tokenString(contract, nameSelector); err != nil {
+		return TokenInfo{}, err
+	}
+	if info.Symbol, err = s.tokenString(contract, symbolSelector); err != nil {
+		return TokenInfo{}, err
+	}
+	s.tokens.put(info)
+	return info, nil
+}
+
+// tokenString calls the optional string function of a token, returning an
+// empty string when it reverts or returns something else. Older tokens
+// return a bytes32 instead, which is decoded too.
+func (s *Invoker) tokenString(contract, selector string) (string, error) {
+	result, err := s.EthCall(contract, selector, Latest)
+	var revert *RevertError
+	if errors.As(err, &revert) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if value, err := DecodeString(result); err == nil {
+		return value, nil
+	}
+	if b, err := decodeHex(result); err == nil && len(b) == 32 {
+		return strings.TrimRight(string(b), "\x00"), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,54 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type rpcCallKey struct{}
+
+// rpcCall describes the JSON-RPC call a request is made for.
+type rpcCall struct {
+	method string
+	block  string
+}
+
+func withRPCCall(ctx context.Context, method string, params interface{}) context.Context {
+	return context.WithValue(ctx, rpcCallKey{}, rpcCall{method: method, block: blockParam(method, params)})
+}
+
+// blockParam returns the block hash, number or tag a block method is called
+// with, always its first parameter.
+func blockParam(method string, params interface{}) string {
+	if !strings.Contains(method, "Block") || strings.HasSuffix(method, "blockNumber") {
+		return ""
+	}
+	switch params := params.(type) {
+	case []string:
+		if len(params) > 0 {
+			return params[0]
+		}
+	case []interface{}:
+		if len(params) > 0 {
+			return fmt.Sprint(params[0])
+		}
+	}
+	return ""
+}
+
+// rpcSpanAttributes names the JSON-RPC method and block of traced requests.
+func rpcSpanAttributes(req *http.Request) []attribute.KeyValue {
+	call, ok := req.Context().Value(rpcCallKey{}).(rpcCall)
+	if !ok {
+		return nil
+	}
+	attrs := []attribute.KeyValue{attribute.String("rpc.method", call.method)}
+	if call.block != "" {
+		attrs = append(attrs, attribute.String("eth.block", call.block))
+	}
+	return attrs
+}
@@ -0,0 +1,91 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/dungnh3/trustwallet-assignment/internal/models"
+	"github.com/dungnh3/trustwallet-assignment/internal/utils"
+	"go.uber.org/zap"
+)
+
+// trigger is the one-shot callback of SubscribeWhen.
+type trigger struct {
+	predicate func(info *models.BlockInfo) bool
+	fn        func()
+}
+
+// SubscribeWhen subscribes address like Subscribe and calls fn once, the
+// first time predicate holds for its progress after a block is recorded, e.g.
+// once its transaction count crosses a threshold. The subscription goes on
+// afterwards; fn may call Unsubscribe to stop it. Calling SubscribeWhen again
+// re-arms the trigger, replacing the previous one if it has not fired.
+// predicate and fn run on the poll loop and must return quickly; a panic in
+// either is logged, a panicking predicate leaving the trigger armed.
+func (s *Invoker) SubscribeWhen(address string, predicate func(info *models.BlockInfo) bool, fn func()) bool {
+	address = utils.NormalizeAddress(address)
+	if predicate == nil || fn == nil {
+		s.logger.Error("failed to subscribe", zap.String("address", address), zap.String("reason", "nil predicate or callback"))
+		return false
+	}
+	s.triggersMutex.Lock()
+	s.triggers[address] = &trigger{predicate: predicate, fn: fn}
+	s.triggersMutex.Unlock()
+	if !s.Subscribe(address) {
+		s.disarm(address)
+		return false
+	}
+	return true
+}
+
+// disarm removes the trigger of address, if any.
+func (s *Invoker) disarm(address string) {
+	s.triggersMutex.Lock()
+	defer s.triggersMutex.Unlock()
+	delete(s.triggers, address)
+}
+
+// fireTrigger calls the trigger of address, disarming it, when its predicate
+// holds for info.
+func (s *Invoker) fireTrigger(address string, info *models.BlockInfo) {
+	s.triggersMutex.Lock()
+	t, ok := s.triggers[address]
+	s.triggersMutex.Unlock()
+	if !ok {
+		return
+	}
+	holds, err := t.holds(info)
+	if err != nil {
+		s.logger.Error("subscription predicate failed", zap.String("address", address), zap.Error(err))
+		return
+	}
+	if !holds {
+		return
+	}
+
+	s.triggersMutex.Lock()
+	// fire once even if re-armed or disarmed meanwhile
+	if s.triggers[address] != t {
+		s.triggersMutex.Unlock()
+		return
+	}
+	delete(s.triggers, address)
+	s.triggersMutex.Unlock()
+	defer func() {
+		if r := recover(); r != nil {
+			s.logger.Error("subscription callback failed", zap.String("address", address), zap.Any("panic", r))
+		}
+	}()
+	t.fn()
+}
+
+// holds evaluates the predicate of t on a copy of info, returning its panic
+// as an error.
+func (t *trigger) holds(info *models.BlockInfo) (holds bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("predicate panicked: %v", r)
+		}
+	}()
+	snapshot := *info
+	return t.predicate(&snapshot), nil
+}
@@ -0,0 +1,160 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dungnh3/trustwallet-assignment/internal/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// ObservabilityOption configures the metrics of WithObservability.
+type ObservabilityOption func(o *observed)
+
+// WithCallsVec counts the calls by method and outcome, see CallsCounterVec.
+func WithCallsVec(vec *prometheus.CounterVec) ObservabilityOption {
+	return func(o *observed) {
+		o.callsVec = vec
+	}
+}
+
+// WithDurationVec times the calls by method and outcome, see
+// DurationHistogramVec.
+func WithDurationVec(vec *prometheus.HistogramVec) ObservabilityOption {
+	return func(o *observed) {
+		o.durationVec = vec
+	}
+}
+
+// CallsCounterVec returns the counter of repository calls, labeled by method
+// and outcome ("success", "not_found" or "error").
+func CallsCounterVec() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "repository_calls_total",
+		Help: "Calls made to the repository.",
+	}, []string{"method", "outcome"})
+}
+
+// DurationHistogramVec returns the histogram of repository call durations,
+// labeled by method and outcome.
+func DurationHistogramVec() *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "repository_call_duration_seconds",
+		Help:    "Duration of the calls made to the repository.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "outcome"})
+}
+
+// WithObservability wraps repo so that every call is logged at debug level,
+// failures at error level, and measured by the metrics given in opts. Errors
+// are returned unchanged. repo itself is returned when logger is nil and no
+// metrics are given.
+func WithObservability(repo Repository, logger *zap.Logger, opts ...ObservabilityOption) Repository {
+	o := &observed{repo: repo, logger: logger}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.logger == nil && o.callsVec == nil && o.durationVec == nil {
+		return repo
+	}
+	if o.logger == nil {
+		o.logger = zap.NewNop()
+	}
+	return o
+}
+
+type observed struct {
+	repo        Repository
+	logger      *zap.Logger
+	callsVec    *prometheus.CounterVec
+	durationVec *prometheus.HistogramVec
+}
+
+func (o *observed) observe(method string, start time.Time, err error) {
+	elapsed := time.Since(start)
+	outcome := "success"
+	switch {
+	case errors.Is(err, ErrNotFound):
+		outcome = "not_found"
+	case err != nil:
+		outcome = "error"
+	}
+	if o.callsVec != nil {
+		o.callsVec.WithLabelValues(method, outcome).Inc()
+	}
+	if o.durationVec != nil {
+		o.durationVec.WithLabelValues(method, outcome).Observe(elapsed.Seconds())
+	}
+	if outcome == "error" {
+		o.logger.Error("repository call failed", zap.String("method", method), zap.Duration("duration", elapsed), zap.Error(err))
+		return
+	}
+	o.logger.Debug("repository call", zap.String("method", method), zap.String("outcome", outcome), zap.Duration("duration", elapsed))
+}
+
+func (o *observed) Ping(ctx context.Context) (err error) {
+	defer func(start time.Time) { o.observe("Ping", start, err) }(time.Now())
+	return o.repo.Ping(ctx)
+}
+
+func (o *observed) GetBlockInfo(ctx context.Context, blockAddress string) (_ *models.BlockInfo, err error) {
+	defer func(start time.Time) { o.observe("GetBlockInfo", start, err) }(time.Now())
+	return o.repo.GetBlockInfo(ctx, blockAddress)
+}
+
+func (o *observed) UpsertBlockInfo(ctx context.Context, blockInfo *models.BlockInfo) (err error) {
+	defer func(start time.Time) { o.observe("UpsertBlockInfo", start, err) }(time.Now())
+	return o.repo.UpsertBlockInfo(ctx, blockInfo)
+}
+
+func (o *observed) CreateBlockTransactions(ctx context.Context, blockTransactions []*models.BlockTransaction) (err error) {
+	defer func(start time.Time) { o.observe("CreateBlockTransactions", start, err) }(time.Now())
+	return o.repo.CreateBlockTransactions(ctx, blockTransactions)
+}
+
+func (o *observed) GetBlockTransactions(ctx context.Context, blockAddress string) (_ []*models.BlockTransaction, err error) {
+	defer func(start time.Time) { o.observe("GetBlockTransactions", start, err) }(time.Now())
+	return o.repo.GetBlockTransactions(ctx, blockAddress)
+}
+
+func (o *observed) ListBlockTransactions(ctx context.Context, filter TransactionFilter) (_ []*models.BlockTransaction, err error) {
+	defer func(start time.Time) { o.observe("ListBlockTransactions", start, err) }(time.Now())
+	return o.repo.ListBlockTransactions(ctx, filter)
+}
+
+func (o *observed) DeleteTransactionsBefore(ctx context.Context, t time.Time) (_ int, err error) {
+	defer func(start time.Time) { o.observe("DeleteTransactionsBefore", start, err) }(time.Now())
+	return o.repo.DeleteTransactionsBefore(ctx, t)
+}
+
+func (o *observed) GetLatestTransaction(ctx context.Context, blockAddress string) (_ *models.BlockTransaction, err error) {
+	defer func(start time.Time) { o.observe("GetLatestTransaction", start, err) }(time.Now())
+	return o.repo.GetLatestTransaction(ctx, blockAddress)
+}
+
+func (o *observed) CountTransactions(ctx context.Context, blockAddress string) (_ int, err error) {
+	defer func(start time.Time) { o.observe("CountTransactions", start, err) }(time.Now())
+	return o.repo.CountTransactions(ctx, blockAddress)
+}
+
+func (o *observed) UpsertBlock(ctx context.Context, block *models.BlockRecord) (err error) {
+	defer func(start time.Time) { o.observe("UpsertBlock", start, err) }(time.Now())
+	return o.repo.UpsertBlock(ctx, block)
+}
+
+func (o *observed) GetBlockByNumber(ctx context.Context, number int) (_ *models.BlockRecord, err error) {
+	defer func(start time.Time) { o.observe("GetBlockByNumber", start, err) }(time.Now())
+	return o.repo.GetBlockByNumber(ctx, number)
+}
+
+// Transact observes the transaction as a whole and every call made through tx.
+func (o *observed) Transact(ctx context.Context, fn func(tx Repository) error) (err error) {
+	defer func(start time.Time) { o.observe("Transact", start, err) }(time.Now())
+	return o.repo.Transact(ctx, func(tx Repository) error {
+		observedTx := *o
+		observedTx.repo = tx
+		return fn(&observedTx)
+	})
+}
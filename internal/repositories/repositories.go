@@ -5,42 +5,297 @@ import (
 	"errors"
 	"github.com/dungnh3/trustwallet-assignment/internal/models"
 	"sync"
+	"time"
 )
 
 var ErrNotFound = errors.New("record not found")
 
 type Repository interface {
+	Ping(ctx context.Context) error
 	GetBlockInfo(ctx context.Context, blockAddress string) (*models.BlockInfo, error)
 	UpsertBlockInfo(ctx context.Context, blockInfo *models.BlockInfo) error
 	CreateBlockTransactions(ctx context.Context, blockTransactions []*models.BlockTransaction) error
+	GetBlockTransactions(ctx context.Context, blockAddress string) ([]*models.BlockTransaction, error)
+	ListBlockTransactions(ctx context.Context, filter TransactionFilter) ([]*models.BlockTransaction, error)
+	// DeleteTransactionsBefore removes the transactions created before t and
+	// returns how many were removed. The Count of the block infos is left as
+	// is, see models.BlockInfo.
+	DeleteTransactionsBefore(ctx context.Context, t time.Time) (int, error)
+	// Transact runs fn so that the writes it makes through tx are committed
+	// together, or not at all when fn returns an error.
+	Transact(ctx context.Context, fn func(tx Repository) error) error
+	// GetLatestTransaction returns the most recently created transaction of
+	// blockAddress, or ErrNotFound.
+	GetLatestTransaction(ctx context.Context, blockAddress string) (*models.BlockTransaction, error)
+	// CountTransactions returns the number of transactions of blockAddress.
+	CountTransactions(ctx context.Context, blockAddress string) (int, error)
+	// UpsertBlock stores the record of a processed block, replacing the one
+	// of the same number.
+	UpsertBlock(ctx context.Context, block *models.BlockRecord) error
+	// GetBlockByNumber returns the record of the block at number, or
+	// ErrNotFound.
+	GetBlockByNumber(ctx context.Context, number int) (*models.BlockRecord, error)
+}
+
+// TransactionFilter selects a page of the transactions of an address, in
+// insertion order. Zero fields do not filter.
+type TransactionFilter struct {
+	BlockAddress string
+	Direction    string
+	// Since is inclusive, Until exclusive, both compared to CreatedAt.
+	Since time.Time
+	Until time.Time
+	// AfterID skips the transactions up to and including this ID.
+	AfterID int
+	Offset  int
+	Limit   int
+}
+
+func (f TransactionFilter) match(blockTransaction *models.BlockTransaction) bool {
+	switch {
+	case blockTransaction.BlockAddress != f.BlockAddress:
+		return false
+	case f.Direction != "" && blockTransaction.Direction != f.Direction:
+		return false
+	case !f.Since.IsZero() && blockTransaction.CreatedAt.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !blockTransaction.CreatedAt.Before(f.Until):
+		return false
+	default:
+		return blockTransaction.ID > f.AfterID
+	}
 }
 
 type InMemory struct {
-	mapBlockInfo      *sync.Map
+	mutex             sync.RWMutex
+	blockInfos        map[string]*models.BlockInfo
+	nextID            int
 	blockTransactions []*models.BlockTransaction
+	// latest indexes the most recently created transaction by address
+	latest map[string]*models.BlockTransaction
+	// counts holds the number of transactions by address
+	counts map[string]int
+	// stored holds the transaction hashes of every address
+	stored map[transactionKey]struct{}
+	// blocks holds the processed blocks by number
+	blocks map[int]*models.BlockRecord
+}
+
+type transactionKey struct {
+	blockAddress       string
+	transactionAddress string
 }
 
 func New() *InMemory {
 	return &InMemory{
-		mapBlockInfo:      &sync.Map{},
+		blockInfos:        make(map[string]*models.BlockInfo),
 		blockTransactions: nil,
+		latest:            make(map[string]*models.BlockTransaction),
+		counts:            make(map[string]int),
+		stored:            make(map[transactionKey]struct{}),
+		blocks:            make(map[int]*models.BlockRecord),
 	}
 }
 
+// Ping always succeeds, there is nothing to connect to.
+func (s *InMemory) Ping(ctx context.Context) error {
+	return nil
+}
+
 func (s *InMemory) GetBlockInfo(ctx context.Context, blockAddress string) (*models.BlockInfo, error) {
-	value, ok := s.mapBlockInfo.Load(blockAddress)
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	blockInfo, ok := s.blockInfos[blockAddress]
 	if !ok {
 		return nil, ErrNotFound
 	}
-	return value.(*models.BlockInfo), nil
+	return blockInfo, nil
 }
 
 func (s *InMemory) UpsertBlockInfo(ctx context.Context, blockInfo *models.BlockInfo) error {
-	s.mapBlockInfo.Store(blockInfo.BlockAddress, blockInfo)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.blockInfos[blockInfo.BlockAddress] = blockInfo
 	return nil
 }
 
 func (s *InMemory) CreateBlockTransactions(ctx context.Context, blockTransactions []*models.BlockTransaction) error {
-	s.blockTransactions = append(s.blockTransactions, blockTransactions...)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.insert(blockTransactions)
+	return nil
+}
+
+// insert stores blockTransactions, the caller holding the mutex. A
+// transaction already stored for the same address is skipped and keeps a
+// zero ID.
+func (s *InMemory) insert(blockTransactions []*models.BlockTransaction) {
+	for _, blockTransaction := range blockTransactions {
+		key := transactionKey{blockTransaction.BlockAddress, blockTransaction.TransactionAddress}
+		if _, ok := s.stored[key]; ok {
+			continue
+		}
+		s.stored[key] = struct{}{}
+		s.counts[blockTransaction.BlockAddress]++
+		s.nextID++
+		blockTransaction.ID = s.nextID
+		latest, ok := s.latest[blockTransaction.BlockAddress]
+		if !ok || !blockTransaction.CreatedAt.Before(latest.CreatedAt) {
+			s.latest[blockTransaction.BlockAddress] = blockTransaction
+		}
+		s.blockTransactions = append(s.blockTransactions, blockTransaction)
+	}
+}
+
+// UpsertBlock stores block by number.
+func (s *InMemory) UpsertBlock(ctx context.Context, block *models.BlockRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.blocks[block.Number] = block
+	return nil
+}
+
+func (s *InMemory) GetBlockByNumber(ctx context.Context, number int) (*models.BlockRecord, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	block, ok := s.blocks[number]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return block, nil
+}
+
+// CountTransactions returns the number of transactions of blockAddress.
+func (s *InMemory) CountTransactions(ctx context.Context, blockAddress string) (int, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.counts[blockAddress], nil
+}
+
+// GetLatestTransaction returns the most recently created transaction of
+// blockAddress, the last inserted one on ties.
+func (s *InMemory) GetLatestTransaction(ctx context.Context, blockAddress string) (*models.BlockTransaction, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	latest, ok := s.latest[blockAddress]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return latest, nil
+}
+
+// GetBlockTransactions returns the transactions recorded for blockAddress in
+// insertion order.
+func (s *InMemory) GetBlockTransactions(ctx context.Context, blockAddress string) ([]*models.BlockTransaction, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var out []*models.BlockTransaction
+	for _, blockTransaction := range s.blockTransactions {
+		if blockTransaction.BlockAddress == blockAddress {
+			out = append(out, blockTransaction)
+		}
+	}
+	return out, nil
+}
+
+// ListBlockTransactions returns the page of transactions matching filter.
+func (s *InMemory) ListBlockTransactions(ctx context.Context, filter TransactionFilter) ([]*models.BlockTransaction, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var out []*models.BlockTransaction
+	skipped := 0
+	for _, blockTransaction := range s.blockTransactions {
+		if !filter.match(blockTransaction) {
+			continue
+		}
+		if skipped < filter.Offset {
+			skipped++
+			continue
+		}
+		out = append(out, blockTransaction)
+		if filter.Limit > 0 && len(out) == filter.Limit {
+			break
+		}
+	}
+	return out, nil
+}
+
+// DeleteTransactionsBefore removes the transactions created before t,
+// leaving the block infos untouched.
+func (s *InMemory) DeleteTransactionsBefore(ctx context.Context, t time.Time) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	kept := s.blockTransactions[:0]
+	for _, blockTransaction := range s.blockTransactions {
+		if !blockTransaction.CreatedAt.Before(t) {
+			kept = append(kept, blockTransaction)
+			continue
+		}
+		delete(s.stored, transactionKey{blockTransaction.BlockAddress, blockTransaction.TransactionAddress})
+		s.counts[blockTransaction.BlockAddress]--
+		if s.counts[blockTransaction.BlockAddress] == 0 {
+			delete(s.counts, blockTransaction.BlockAddress)
+		}
+	}
+	deleted := len(s.blockTransactions) - len(kept)
+	for address, latest := range s.latest {
+		// every transaction of address is as old as its latest one
+		if latest.CreatedAt.Before(t) {
+			delete(s.latest, address)
+		}
+	}
+	// release the removed pointers held past the new length
+	clear(s.blockTransactions[len(kept):])
+	s.blockTransactions = kept
+	return deleted, nil
+}
+
+// Transact runs fn against a transaction buffering the block infos, blocks
+// and transactions written through it, committed under the mutex once fn
+// returns nil, so readers see all of them or none. It is not isolated:
+// reads through tx do not see its pending writes, and other writes are
+// applied immediately. Nested calls join the outer transaction.
+func (s *InMemory) Transact(ctx context.Context, fn func(tx Repository) error) error {
+	tx := &inMemoryTx{InMemory: s}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.insert(tx.blockTransactions)
+	for _, blockInfo := range tx.blockInfos {
+		s.blockInfos[blockInfo.BlockAddress] = blockInfo
+	}
+	for _, block := range tx.blocks {
+		s.blocks[block.Number] = block
+	}
 	return nil
 }
+
+type inMemoryTx struct {
+	*InMemory
+
+	blockInfos        []*models.BlockInfo
+	blockTransactions []*models.BlockTransaction
+	blocks            []*models.BlockRecord
+}
+
+func (tx *inMemoryTx) UpsertBlockInfo(ctx context.Context, blockInfo *models.BlockInfo) error {
+	tx.blockInfos = append(tx.blockInfos, blockInfo)
+	return nil
+}
+
+func (tx *inMemoryTx) CreateBlockTransactions(ctx context.Context, blockTransactions []*models.BlockTransaction) error {
+	tx.blockTransactions = append(tx.blockTransactions, blockTransactions...)
+	return nil
+}
+
+func (tx *inMemoryTx) UpsertBlock(ctx context.Context, block *models.BlockRecord) error {
+	tx.blocks = append(tx.blocks, block)
+	return nil
+}
+
+func (tx *inMemoryTx) Transact(ctx context.Context, fn func(tx Repository) error) error {
+	return fn(tx)
+}
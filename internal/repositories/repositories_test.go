@@ -0,0 +1,176 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dungnh3/trustwallet-assignment/internal/models"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+func TestWithObservability(t *testing.T) {
+	repo := New()
+	if WithObservability(repo, nil) != Repository(repo) {
+		t.Error("expected the repository itself without logger nor metrics")
+	}
+
+	calls := CallsCounterVec()
+	observed := WithObservability(repo, zap.NewNop(), WithCallsVec(calls), WithDurationVec(DurationHistogramVec()))
+	ctx := context.Background()
+	if _, err := observed.GetBlockInfo(ctx, "0xabc"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound unchanged, got %v", err)
+	}
+	if err := observed.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := testutil.ToFloat64(calls.WithLabelValues("GetBlockInfo", "not_found")); n != 1 {
+		t.Errorf("expected 1 not found GetBlockInfo call, got %v", n)
+	}
+	if n := testutil.ToFloat64(calls.WithLabelValues("Ping", "success")); n != 1 {
+		t.Errorf("expected 1 successful Ping call, got %v", n)
+	}
+}
+
+func TestInMemory_DeleteTransactionsBefore(t *testing.T) {
+	ctx := context.Background()
+	repo := New()
+	now := time.Now()
+	if deleted, err := repo.DeleteTransactionsBefore(ctx, now); deleted != 0 || err != nil {
+		t.Errorf("expected (0, nil) on an empty store, got (%d, %v)", deleted, err)
+	}
+
+	repo.CreateBlockTransactions(ctx, []*models.BlockTransaction{
+		{BlockAddress: "0xabc", TransactionAddress: "0x01", CreatedAt: now.Add(-2 * time.Hour)},
+		{BlockAddress: "0xabc", TransactionAddress: "0x02", CreatedAt: now},
+		{BlockAddress: "0xabc", TransactionAddress: "0x03", CreatedAt: now.Add(-time.Hour - time.Second)},
+	})
+	repo.UpsertBlockInfo(ctx, &models.BlockInfo{BlockAddress: "0xabc", Count: 3})
+	deleted, err := repo.DeleteTransactionsBefore(ctx, now.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 2 {
+		t.Errorf("expected 2 deleted, got %d", deleted)
+	}
+	kept, _ := repo.GetBlockTransactions(ctx, "0xabc")
+	if len(kept) != 1 || kept[0].TransactionAddress != "0x02" {
+		t.Errorf("expected only 0x02 kept, got %v", kept)
+	}
+	// the count of recorded transactions is not lowered
+	if blockInfo, _ := repo.GetBlockInfo(ctx, "0xabc"); blockInfo.Count != 3 {
+		t.Errorf("expected the count left at 3, got %d", blockInfo.Count)
+	}
+}
+
+func TestInMemory_Transact(t *testing.T) {
+	ctx := context.Background()
+	repo := New()
+	write := func(tx Repository) error {
+		if err := tx.CreateBlockTransactions(ctx, []*models.BlockTransaction{{BlockAddress: "0xabc"}}); err != nil {
+			return err
+		}
+		return tx.UpsertBlockInfo(ctx, &models.BlockInfo{BlockAddress: "0xabc", Count: 1})
+	}
+
+	failure := errors.New("failure")
+	err := repo.Transact(ctx, func(tx Repository) error {
+		if err := write(tx); err != nil {
+			return err
+		}
+		return failure
+	})
+	if err != failure {
+		t.Fatalf("expected the error of fn, got %v", err)
+	}
+	if _, err := repo.GetBlockInfo(ctx, "0xabc"); err != ErrNotFound {
+		t.Errorf("expected nothing committed, got %v", err)
+	}
+
+	if err := repo.Transact(ctx, write); err != nil {
+		t.Fatal(err)
+	}
+	transactions, _ := repo.GetBlockTransactions(ctx, "0xabc")
+	if blockInfo, err := repo.GetBlockInfo(ctx, "0xabc"); err != nil || blockInfo.Count != len(transactions) {
+		t.Errorf("expected the count to match %d transactions, got %v, %v", len(transactions), blockInfo, err)
+	}
+}
+
+func TestInMemory_GetLatestTransaction(t *testing.T) {
+	ctx := context.Background()
+	repo := New()
+	if _, err := repo.GetLatestTransaction(ctx, "0xabc"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	now := time.Now()
+	repo.CreateBlockTransactions(ctx, []*models.BlockTransaction{
+		{BlockAddress: "0xabc", TransactionAddress: "0x01", CreatedAt: now.Add(-time.Hour)},
+		{BlockAddress: "0xabc", TransactionAddress: "0x02", CreatedAt: now},
+		{BlockAddress: "0xabc", TransactionAddress: "0x03", CreatedAt: now.Add(-time.Minute)},
+		{BlockAddress: "0xdef", TransactionAddress: "0x04", CreatedAt: now.Add(time.Hour)},
+	})
+	if latest, err := repo.GetLatestTransaction(ctx, "0xabc"); err != nil || latest.TransactionAddress != "0x02" {
+		t.Errorf("expected 0x02, got %v, %v", latest, err)
+	}
+
+	repo.DeleteTransactionsBefore(ctx, now.Add(time.Minute))
+	if _, err := repo.GetLatestTransaction(ctx, "0xabc"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound once pruned, got %v", err)
+	}
+	if latest, err := repo.GetLatestTransaction(ctx, "0xdef"); err != nil || latest.TransactionAddress != "0x04" {
+		t.Errorf("expected 0x04, got %v, %v", latest, err)
+	}
+}
+
+func TestInMemory_CountTransactions(t *testing.T) {
+	ctx := context.Background()
+	repo := New()
+	count := func(expected int) {
+		t.Helper()
+		if n, err := repo.CountTransactions(ctx, "0xabc"); err != nil || n != expected {
+			t.Errorf("expected %d transactions, got %d, %v", expected, n, err)
+		}
+	}
+	count(0)
+
+	now := time.Now()
+	repo.CreateBlockTransactions(ctx, []*models.BlockTransaction{
+		{BlockAddress: "0xabc", TransactionAddress: "0x01", CreatedAt: now.Add(-time.Hour)},
+		{BlockAddress: "0xabc", TransactionAddress: "0x02", CreatedAt: now},
+		{BlockAddress: "0xdef", TransactionAddress: "0x02", CreatedAt: now},
+	})
+	count(2)
+
+	duplicate := &models.BlockTransaction{BlockAddress: "0xabc", TransactionAddress: "0x01", CreatedAt: now}
+	repo.CreateBlockTransactions(ctx, []*models.BlockTransaction{duplicate})
+	count(2)
+	if duplicate.ID != 0 {
+		t.Errorf("expected the duplicate to be skipped, got ID %d", duplicate.ID)
+	}
+
+	repo.DeleteTransactionsBefore(ctx, now.Add(-time.Minute))
+	count(1)
+	repo.CreateBlockTransactions(ctx, []*models.BlockTransaction{
+		{BlockAddress: "0xabc", TransactionAddress: "0x01", CreatedAt: now},
+	})
+	count(2)
+}
+
+func TestInMemory_blocks(t *testing.T) {
+	ctx := context.Background()
+	repo := New()
+	if _, err := repo.GetBlockByNumber(ctx, 10); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	repo.UpsertBlock(ctx, &models.BlockRecord{Number: 10, Hash: "0xaa"})
+	repo.Transact(ctx, func(tx Repository) error {
+		return tx.UpsertBlock(ctx, &models.BlockRecord{Number: 10, Hash: "0xbb", ParentHash: "0x99"})
+	})
+	block, err := repo.GetBlockByNumber(ctx, 10)
+	if err != nil || block.Hash != "0xbb" || block.ParentHash != "0x99" {
+		t.Errorf("expected the replaced block, got %+v, %v", block, err)
+	}
+}
@@ -1,7 +1,20 @@
 package utils
 
 import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"regexp"
 	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+var (
+	hexRe        = regexp.MustCompile(`^0[xX][0-9a-fA-F]+$`)
+	hexAddressRe = regexp.MustCompile(`^0[xX][0-9a-fA-F]{40}$`)
+	hexHashRe    = regexp.MustCompile(`^0[xX][0-9a-fA-F]{64}$`)
 )
 
 func ConvertHexToDec(hexString string) int {
@@ -11,3 +24,55 @@ func ConvertHexToDec(hexString string) int {
 	}
 	return int(decimalInt)
 }
+
+// ParseHexBig parses a 0x-prefixed hex quantity of any size.
+func ParseHexBig(hexString string) (*big.Int, error) {
+	if !IsHex(hexString) {
+		return nil, fmt.Errorf("%q is not a hex quantity", hexString)
+	}
+	n, ok := new(big.Int).SetString(hexString[2:], 16)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a hex quantity", hexString)
+	}
+	return n, nil
+}
+
+func IsHex(s string) bool {
+	return hexRe.MatchString(s)
+}
+
+// IsHexAddress reports whether s is a 0x-prefixed 20-byte account address.
+func IsHexAddress(s string) bool {
+	return hexAddressRe.MatchString(s)
+}
+
+// IsHexHash reports whether s is a 0x-prefixed 32-byte hash, such as a block
+// or transaction hash.
+func IsHexHash(s string) bool {
+	return hexHashRe.MatchString(s)
+}
+
+// NormalizeAddress returns the lowercase form of a hex address, so that
+// checksummed and plain spellings of an address compare equal.
+func NormalizeAddress(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+// Keccak256 returns the Keccak-256 hash of data, as used by Ethereum.
+func Keccak256(data []byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// MethodSelector returns the 0x-prefixed selector of a function signature
+// such as "transfer(address,uint256)", the first 4 bytes of its hash.
+func MethodSelector(signature string) string {
+	return "0x" + hex.EncodeToString(Keccak256([]byte(signature))[:4])
+}
+
+// EventTopic returns the 0x-prefixed topic of an event signature such as
+// "Transfer(address,address,uint256)", the first topic of its logs.
+func EventTopic(signature string) string {
+	return "0x" + hex.EncodeToString(Keccak256([]byte(signature)))
+}
@@ -0,0 +1,77 @@
+package utils
+
+import "testing"
+
+func TestIsHexAddress(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected bool
+	}{
+		{"0x00000000219ab540356cBB839Cbe05303d7705Fa", true},
+		{"0X00000000219AB540356CBB839CBE05303D7705FA", true},
+		{"0x0000000000000000000000000000000000000000", true},
+		{"", false},
+		{"0x", false},
+		{"0x12ebe0a", false},
+		{"00000000219ab540356cBB839Cbe05303d7705Fa", false},
+		{"0x00000000219ab540356cBB839Cbe05303d7705Fa00", false},
+		{"0x00000000219ab540356cBB839Cbe05303d7705Fg", false},
+		{" 0x00000000219ab540356cBB839Cbe05303d7705Fa", false},
+	}
+	for _, c := range cases {
+		if got := IsHexAddress(c.input); got != c.expected {
+			t.Errorf("IsHexAddress(%q): expected %v, got %v", c.input, c.expected, got)
+		}
+	}
+}
+
+func TestIsHexHash(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected bool
+	}{
+		{"0x88df016429689c079f3b2f6ad39fa052532c56795b733da78a91ebe6a713944b", true},
+		{"0x00000000219ab540356cBB839Cbe05303d7705Fa", false},
+		{"0x1b4", false},
+		{"88df016429689c079f3b2f6ad39fa052532c56795b733da78a91ebe6a713944b", false},
+	}
+	for _, c := range cases {
+		if got := IsHexHash(c.input); got != c.expected {
+			t.Errorf("IsHexHash(%q): expected %v, got %v", c.input, c.expected, got)
+		}
+	}
+}
+
+func TestParseHexBig(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected string
+	}{
+		{"0x5208", "21000"},
+		{"0X0", "0"},
+		{"0xffffffffffffffffffffffffffffffff", "340282366920938463463374607431768211455"},
+		{"", ""},
+		{"0x", ""},
+		{"5208", ""},
+		{"0xzz", ""},
+	}
+	for _, c := range cases {
+		n, err := ParseHexBig(c.input)
+		switch {
+		case c.expected == "" && err == nil:
+			t.Errorf("ParseHexBig(%q): expected an error, got %s", c.input, n)
+		case c.expected != "" && (err != nil || n.String() != c.expected):
+			t.Errorf("ParseHexBig(%q): expected %s, got %v, %v", c.input, c.expected, n, err)
+		}
+	}
+}
+
+func TestKeccakSelectors(t *testing.T) {
+	if selector := MethodSelector("transfer(address,uint256)"); selector != "0xa9059cbb" {
+		t.Errorf("expected 0xa9059cbb, got %s", selector)
+	}
+	expected := "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+	if topic := EventTopic("Transfer(address,address,uint256)"); topic != expected {
+		t.Errorf("expected %s, got %s", expected, topic)
+	}
+}
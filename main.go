@@ -2,25 +2,144 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"github.com/dungnh3/trustwallet-assignment/grpcserver"
+	"github.com/dungnh3/trustwallet-assignment/internal/config"
 	"github.com/dungnh3/trustwallet-assignment/internal/parser"
 	"github.com/dungnh3/trustwallet-assignment/internal/repositories"
+	"github.com/dungnh3/trustwallet-assignment/server"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
-	ctx := context.Background()
-	host := "https://cloudflare-eth.com"
-	repo := repositories.New()
-	invoker := parser.New(ctx, host, repo)
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration: %v\n", err)
+		os.Exit(2)
+	}
 
-	address := "0x12ebe0a"
+	logger, _ := zap.NewProduction()
+	err = run(cfg, logger)
+	if err != nil {
+		logger.Error("failed to run", zap.Error(err))
+	}
+	logger.Sync()
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+// run serves the parser until SIGINT or SIGTERM, then stops the servers and
+// only then the parser, so that in-flight polls and writes finish.
+func run(cfg *config.Config, logger *zap.Logger) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	prometheus.MustRegister(parser.Collectors()...)
+	repoCalls, repoDuration := repositories.CallsCounterVec(), repositories.DurationHistogramVec()
+	prometheus.MustRegister(repoCalls, repoDuration)
+
+	repo := repositories.WithObservability(repositories.New(), logger,
+		repositories.WithCallsVec(repoCalls),
+		repositories.WithDurationVec(repoDuration),
+	)
+	// the parser outlives the signal, Close drains it once nothing is served
+	parserCtx, cancelParser := context.WithCancel(context.Background())
+	defer cancelParser()
+	invoker := parser.New(parserCtx, cfg.RPCHost, repo,
+		parser.WithInterval(cfg.PollInterval),
+		parser.WithRetention(cfg.Retention, 0),
+	)
+	defer func() {
+		if err := invoker.Close(); err != nil {
+			logger.Error("failed to close parser", zap.Error(err))
+		}
+	}()
+
+	if err := selfTest(ctx, cfg, invoker, repo); err != nil {
+		return fmt.Errorf("startup self-test failed: %w", err)
+	}
 
-	currentBlock := invoker.GetCurrentBlock()
-	fmt.Printf("Current block is: %d\n", currentBlock)
+	var grpcLn net.Listener
+	if cfg.GRPCAddr != "" {
+		var err error
+		grpcLn, err = net.Listen("tcp", cfg.GRPCAddr)
+		if err != nil {
+			return fmt.Errorf("failed to listen for grpc: %w", err)
+		}
+	}
+
+	srv := server.New(invoker,
+		server.WithLogger(logger),
+		server.WithRateLimit(cfg.RateLimit, cfg.RateBurst),
+	)
+	go func() {
+		if err := srv.ListenAndServe(cfg.ServerAddr); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("server stopped unexpectedly", zap.Error(err))
+			stop()
+		}
+	}()
+
+	var grpcSrv *grpc.Server
+	if grpcLn != nil {
+		grpcSrv = grpc.NewServer()
+		grpcserver.Register(grpcSrv, invoker)
+		go func() {
+			logger.Info("grpc server listening", zap.String("addr", grpcLn.Addr().String()))
+			if err := grpcSrv.Serve(grpcLn); err != nil {
+				logger.Error("grpc server stopped unexpectedly", zap.Error(err))
+				stop()
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	logger.Info("shutting down", zap.Duration("timeout", cfg.ShutdownTimeout))
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Error("failed to shutdown server", zap.Error(err))
+	}
+	if grpcSrv != nil {
+		stopped := make(chan struct{})
+		go func() {
+			grpcSrv.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-shutdownCtx.Done():
+			logger.Warn("grpc server did not drain in time, stopping it")
+			grpcSrv.Stop()
+		}
+	}
+	return nil
+}
 
-	transactions := invoker.GetTransactions(address)
-	fmt.Println(transactions)
+// selfTest checks that the RPC node and the storage backend are reachable
+// before anything is served.
+func selfTest(ctx context.Context, cfg *config.Config, p parser.Parser, repo repositories.Repository) error {
+	ctx, cancel := context.WithTimeout(ctx, cfg.StartupTimeout)
+	defer cancel()
 
-	isSubscribed := invoker.Subscribe(address)
-	fmt.Println(isSubscribed)
+	if _, err := p.ChainID(ctx); err != nil {
+		return fmt.Errorf("rpc node %s is not reachable: %w", cfg.RPCHost, err)
+	}
+	if err := repo.Ping(ctx); err != nil {
+		return fmt.Errorf("storage backend %s is not reachable: %w", cfg.StorageBackend, err)
+	}
+	return nil
 }
@@ -2,6 +2,7 @@ package rest
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"encoding/xml"
 	"io"
@@ -40,9 +41,19 @@ func (p bodyProvider) Body() (io.Reader, error) {
 }
 
 // jsonBodyProvider encodes a JSON tagged struct value as a Body for requests.
+// The encoding is deterministic: struct fields keep their order and map keys
+// are sorted, so equal payloads always produce the same bytes.
 // See https://golang.org/pkg/encoding/json/#MarshalIndent for details.
 type jsonBodyProvider struct {
-	payload interface{}
+	payload  interface{}
+	encoding jsonEncoding
+}
+
+// jsonEncoding configures the encoder of jsonBodyProvider, see
+// WithJSONEncoderOptions. The zero value is the encoding/json default.
+type jsonEncoding struct {
+	noEscapeHTML bool
+	indent       string
 }
 
 func (p jsonBodyProvider) ContentType() string {
@@ -51,7 +62,10 @@ func (p jsonBodyProvider) ContentType() string {
 
 func (p jsonBodyProvider) Body() (io.Reader, error) {
 	buf := &bytes.Buffer{}
-	err := json.NewEncoder(buf).Encode(p.payload)
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(!p.encoding.noEscapeHTML)
+	encoder.SetIndent("", p.encoding.indent)
+	err := encoder.Encode(p.payload)
 	if err != nil {
 		return nil, err
 	}
@@ -76,6 +90,28 @@ func (p formBodyProvider) Body() (io.Reader, error) {
 	return strings.NewReader(values.Encode()), nil
 }
 
+// formExtraBodyProvider encodes a url tagged struct with extra values set over
+// the ones of the struct.
+type formExtraBodyProvider struct {
+	payload interface{}
+	extra   map[string]string
+}
+
+func (p formExtraBodyProvider) ContentType() string {
+	return formContentType
+}
+
+func (p formExtraBodyProvider) Body() (io.Reader, error) {
+	values, err := goquery.Values(p.payload)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range p.extra {
+		values.Set(key, value)
+	}
+	return strings.NewReader(values.Encode()), nil
+}
+
 // formUrlEncoded, sometime formBodyProvider doesn't worked, so we manual encode
 
 type formUrlEncodedProvider struct {
@@ -152,3 +188,31 @@ func (p xmlProvider) Body() (io.Reader, error) {
 	}
 	return bytes.NewReader(values), nil
 }
+
+// gzipBody returns body compressed with gzip, buffered so that the request
+// has a known length and can be rewound.
+func gzipBody(body io.Reader) (io.Reader, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := io.Copy(zw, body); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+// knownLengthBody returns body, buffered unless http.NewRequest can tell its
+// length.
+func knownLengthBody(body io.Reader) (io.Reader, error) {
+	switch body.(type) {
+	case *bytes.Buffer, *bytes.Reader, *strings.Reader:
+		return body, nil
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(b), nil
+}
@@ -0,0 +1,96 @@
+package rest
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"runtime"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// DialContextFunc dials a network connection, see WithDialContext.
+type DialContextFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// DefaultTransport returns a new http.Transport with keep-alives disabled,
+// for clients doing a single request to a host.
+func DefaultTransport() *http.Transport {
+	transport := DefaultPooledTransport()
+	transport.DisableKeepAlives = true
+	transport.MaxIdleConnsPerHost = -1
+	return transport
+}
+
+// DefaultPooledTransport returns a new http.Transport keeping connections
+// alive for reuse, for clients doing repeated requests to the same hosts.
+// Clients must share it rather than create a new one per request.
+func DefaultPooledTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   runtime.GOMAXPROCS(0) + 1,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// DefaultClient returns a new http.Client using a DefaultTransport.
+func DefaultClient() *http.Client {
+	return &http.Client{
+		Transport: DefaultTransport(),
+	}
+}
+
+// DefaultPooledClient returns a new http.Client using a DefaultPooledTransport.
+// It is the client of New when WithHttpClient is not given.
+func DefaultPooledClient() *http.Client {
+	return &http.Client{
+		Transport: DefaultPooledTransport(),
+	}
+}
+
+// dialingClient returns a copy of doer dialing with dial, or doer itself when
+// its transport cannot be configured.
+func dialingClient(doer Doer, dial DialContextFunc) Doer {
+	client, ok := doer.(*http.Client)
+	if !ok {
+		return doer
+	}
+	var transport *http.Transport
+	switch t := client.Transport.(type) {
+	case nil:
+		transport = DefaultPooledTransport()
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		return doer
+	}
+	transport.DialContext = dial
+
+	clientCopy := *client
+	clientCopy.Transport = transport
+	return &clientCopy
+}
+
+// tracedClient returns a copy of doer tracing its requests.
+func tracedClient(doer Doer, opts []otelhttp.Option) Doer {
+	client, ok := doer.(*http.Client)
+	if !ok {
+		client = DefaultPooledClient()
+	}
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	clientCopy := *client
+	clientCopy.Transport = otelhttp.NewTransport(spanAttributesTransport{base: base}, opts...)
+	return &clientCopy
+}
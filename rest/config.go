@@ -1,5 +1,12 @@
 package rest
 
+import (
+	"net"
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
 type config struct {
 	// http Client for doing requests
 	httpClient Doer
@@ -7,6 +14,18 @@ type config struct {
 	responseDecoder ResponseDecoder
 	// func success decider
 	isSuccess SuccessDecider
+	// attributes added to the span of each request
+	spanAttributes SpanAttributesFunc
+	// dials the connections of httpClient, nil for its own dialer
+	dialContext DialContextFunc
+	// otelhttp options tracing httpClient, nil when not traced
+	otel []otelhttp.Option
+	// encoding of JSON bodies
+	jsonEncoding jsonEncoding
+	// headers sent with every request, see WithBaseHeaders
+	baseHeader http.Header
+	// records the requests sent, nil when not recording
+	recorder *Recorder
 }
 
 type Option interface {
@@ -29,9 +48,49 @@ func newConfig(opts ...Option) *config {
 		opt.apply(c)
 	}
 
+	// transport options apply whatever their position relative to
+	// WithHttpClient
+	if c.dialContext != nil {
+		c.httpClient = dialingClient(c.httpClient, c.dialContext)
+	}
+	if c.otel != nil {
+		c.httpClient = tracedClient(c.httpClient, c.otel)
+	}
 	return c
 }
 
+// WithJSONEncoderOptions sets how BodyJSON encodes bodies: whether <, > and &
+// are escaped in strings, and the indent of nested values, none when empty.
+// By default HTML is escaped and nothing is indented.
+func WithJSONEncoderOptions(escapeHTML bool, indent string) Option {
+	return optionFunc(func(c *config) {
+		c.jsonEncoding = jsonEncoding{noEscapeHTML: !escapeHTML, indent: indent}
+	})
+}
+
+// WithBaseHeaders sets headers sent with every request of the Rest and its
+// clones. They are fixed at construction, and a header of the same name set
+// on a request, e.g. with SetHeader, replaces them.
+func WithBaseHeaders(headers map[string]string) Option {
+	return optionFunc(func(c *config) {
+		if c.baseHeader == nil {
+			c.baseHeader = make(http.Header)
+		}
+		for key, value := range headers {
+			c.baseHeader.Set(key, value)
+		}
+	})
+}
+
+// WithRequestRecorder records every request sent by the Rest and its clones
+// in rec, see Recorder. Unlike Debug, the requests are available to the
+// program, e.g. to tests.
+func WithRequestRecorder(rec *Recorder) Option {
+	return optionFunc(func(c *config) {
+		c.recorder = rec
+	})
+}
+
 func WithHttpClient(httpClient Doer) Option {
 	return optionFunc(func(c *config) {
 		if httpClient != nil {
@@ -52,6 +111,25 @@ func WithXmlResponseDecoder() Option {
 	})
 }
 
+// WithContentTypeDecoder decodes responses as JSON or XML according to their
+// Content-Type, see WithFallbackDecoder.
+func WithContentTypeDecoder() Option {
+	return WithFallbackDecoder(jsonDecoder{})
+}
+
+// WithFallbackDecoder decodes responses as JSON or XML according to their
+// Content-Type, or their first byte when it is missing or unknown, and with
+// fallback when neither tells. It makes lenient servers omitting the
+// Content-Type decodable.
+func WithFallbackDecoder(fallback ResponseDecoder) Option {
+	return optionFunc(func(c *config) {
+		if fallback == nil {
+			fallback = jsonDecoder{}
+		}
+		c.responseDecoder = contentTypeDecoder{fallback: fallback}
+	})
+}
+
 func WithResponseDecoder(decoder ResponseDecoder) Option {
 	return optionFunc(func(c *config) {
 		if decoder != nil {
@@ -67,3 +145,42 @@ func WithSuccessDecider(is SuccessDecider) Option {
 		}
 	})
 }
+
+// WithOtel traces requests with an otelhttp transport. Requests built after
+// NoTrace, or with a WithoutTracing context, go through the same transport
+// but create no span.
+// The transport wraps the one of the http client, which must be an
+// *http.Client; other Doers are replaced by a DefaultPooledClient.
+func WithOtel(opts ...otelhttp.Option) Option {
+	return optionFunc(func(c *config) {
+		c.otel = append([]otelhttp.Option{otelhttp.WithFilter(tracingEnabled)}, opts...)
+	})
+}
+
+// WithSpanAttributes adds the attributes returned by fn to the span of each
+// request traced by WithOtel.
+func WithSpanAttributes(fn SpanAttributesFunc) Option {
+	return optionFunc(func(c *config) {
+		c.spanAttributes = fn
+	})
+}
+
+// WithDialer dials every connection with dialer, e.g. to bind a local
+// address on multi-homed hosts. See WithDialContext.
+func WithDialer(dialer *net.Dialer) Option {
+	if dialer == nil {
+		return optionFunc(func(*config) {})
+	}
+	return WithDialContext(dialer.DialContext)
+}
+
+// WithDialContext dials every connection with dial, e.g. to use a custom
+// resolver. It replaces the default dialer entirely, so timeouts and
+// keep-alives are up to dial; TLS and proxy settings of the transport still
+// apply on top of it. It only has an effect when the http client is an
+// *http.Client with an *http.Transport, which is copied rather than modified.
+func WithDialContext(dial DialContextFunc) Option {
+	return optionFunc(func(c *config) {
+		c.dialContext = dial
+	})
+}
@@ -0,0 +1,56 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+)
+
+const problemContentType = "application/problem+json"
+
+// ProblemDetail is an RFC 7807 problem details object.
+type ProblemDetail struct {
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Status   int    `json:"status,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+// ProblemError is returned by Receive and Do for application/problem+json
+// failure responses when no failureV is given.
+type ProblemError struct {
+	Problem ProblemDetail
+}
+
+func (e *ProblemError) Error() string {
+	msg := e.Problem.Title
+	if msg == "" {
+		msg = e.Problem.Type
+	}
+	if e.Problem.Detail != "" {
+		msg += ": " + e.Problem.Detail
+	}
+	if e.Problem.Status != 0 {
+		msg = fmt.Sprintf("%s (status %d)", msg, e.Problem.Status)
+	}
+	return msg
+}
+
+func isProblem(resp *http.Response) bool {
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get(hdrContentTypeKey))
+	return err == nil && mediaType == problemContentType
+}
+
+// decodeProblem decodes the problem+json body of resp into a *ProblemError.
+func decodeProblem(resp *http.Response) error {
+	var problem ProblemDetail
+	if err := json.NewDecoder(resp.Body).Decode(&problem); err != nil {
+		return err
+	}
+	if problem.Status == 0 {
+		problem.Status = resp.StatusCode
+	}
+	return &ProblemError{Problem: problem}
+}
@@ -0,0 +1,95 @@
+package rest
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+)
+
+// receiveOptions are the decoding targets of a ReceiveWith call.
+type receiveOptions struct {
+	successV interface{}
+	failureV interface{}
+	raw      *Raw
+}
+
+// ReceiveOption configures how ReceiveWith handles the response.
+type ReceiveOption func(*receiveOptions)
+
+// Into decodes success responses into the value pointed to by v, or keeps
+// their raw body when v is a *Raw.
+func Into(v interface{}) ReceiveOption {
+	return func(o *receiveOptions) {
+		o.successV = v
+	}
+}
+
+// OnError decodes the responses that are not a success into the value
+// pointed to by v, or keeps their raw body when v is a *Raw.
+func OnError(v interface{}) ReceiveOption {
+	return func(o *receiveOptions) {
+		o.failureV = v
+	}
+}
+
+// RawInto keeps the raw body of the response in b, whatever its status, in
+// addition to decoding it, e.g. to log the body a typed value was decoded
+// from.
+func RawInto(b *Raw) ReceiveOption {
+	return func(o *receiveOptions) {
+		o.raw = b
+	}
+}
+
+// ToWriter copies the body of success responses to w instead of decoding
+// it, e.g. to stream a download to a file. It replaces Into.
+func ToWriter(w io.Writer) ReceiveOption {
+	return Into(writerTarget{w: w})
+}
+
+// ReceiveWith is Receive with the handling of the response given by opts
+// rather than positional values, e.g.
+//
+//	s.ReceiveWith(rest.Into(&result), rest.OnError(&apiErr), rest.RawInto(&body))
+//
+// Without options the body is discarded, like Receive(nil, nil).
+func (s *Rest) ReceiveWith(opts ...ReceiveOption) (*Response, error) {
+	var o receiveOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	successV, failureV := o.successV, o.failureV
+	if o.raw != nil {
+		successV = rawTee{raw: o.raw, v: successV}
+		failureV = rawTee{raw: o.raw, v: failureV}
+	}
+	req, err := s.Request()
+	if err != nil {
+		return nil, err
+	}
+	return s.Do(req, successV, failureV)
+}
+
+// writerTarget is a decoding target copying the body to w, see ToWriter.
+type writerTarget struct {
+	w io.Writer
+}
+
+// rawTee is a decoding target keeping the raw body in raw before decoding it
+// into v, see RawInto.
+type rawTee struct {
+	raw *Raw
+	v   interface{}
+}
+
+// capture reads the body of resp into t.raw and puts it back to be decoded,
+// returning the target to decode it into.
+func (t rawTee) capture(resp *http.Response) (interface{}, error) {
+	body, err := io.ReadAll(resp.Body)
+	*t.raw = body
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return t.v, nil
+}
@@ -0,0 +1,98 @@
+package rest
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// RecordedRequest is a request as sent by a Rest, see Recorder.
+type RecordedRequest struct {
+	Method string
+	URL    string
+	Header http.Header
+	Body   []byte
+}
+
+// Recorder keeps the last requests sent by the Rest clients it is given to
+// with WithRequestRecorder, for tests to assert exactly what was sent. It is
+// safe for concurrent use.
+type Recorder struct {
+	size int
+
+	mutex    sync.Mutex
+	requests []RecordedRequest
+}
+
+// NewRecorder returns a Recorder keeping the last size requests, at least
+// one.
+func NewRecorder(size int) *Recorder {
+	return &Recorder{size: max(size, 1)}
+}
+
+// Requests returns the recorded requests, oldest first.
+func (r *Recorder) Requests() []RecordedRequest {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]RecordedRequest(nil), r.requests...)
+}
+
+// Last returns the most recent request, false when none was recorded.
+func (r *Recorder) Last() (RecordedRequest, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if len(r.requests) == 0 {
+		return RecordedRequest{}, false
+	}
+	return r.requests[len(r.requests)-1], true
+}
+
+// Reset forgets the recorded requests.
+func (r *Recorder) Reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.requests = nil
+}
+
+// record keeps a copy of req, once per request whatever the retries. A body
+// that cannot be read again is buffered and put back in req.
+func (r *Recorder) record(req *http.Request) error {
+	if r == nil {
+		return nil
+	}
+	recorded := RecordedRequest{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Header: req.Header.Clone(),
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			body, err := io.ReadAll(req.Body)
+			req.Body.Close()
+			if err != nil {
+				return err
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			req.GetBody = func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(body)), nil
+			}
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return err
+		}
+		defer body.Close()
+		if recorded.Body, err = io.ReadAll(body); err != nil {
+			return err
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.requests = append(r.requests, recorded)
+	if len(r.requests) > r.size {
+		r.requests = append(r.requests[:0:0], r.requests[len(r.requests)-r.size:]...)
+	}
+	return nil
+}
@@ -1,9 +1,21 @@
 package rest
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
 )
 
 // Raw is response's raw data
@@ -12,11 +24,29 @@ type Raw []byte
 // Response is a http response wrapper
 type Response struct {
 	*http.Response
+
+	// Duration is the wall time of the Do call, including every retry made
+	// by a RetryDoer.
+	Duration time.Duration
+	// ReceivedAt is when the response, or the error, was received.
+	ReceivedAt time.Time
+
+	requestURL *url.URL
+}
+
+// RequestURL returns the URL the request was sent to, with its query
+// params merged in, or "" when no request was sent.
+func (r *Response) RequestURL() string {
+	if r == nil || r.requestURL == nil {
+		return ""
+	}
+	return r.requestURL.String()
 }
 
 func NewResponse(response *http.Response) *Response {
 	return &Response{
-		Response: response,
+		Response:   response,
+		ReceivedAt: time.Now(),
 	}
 }
 
@@ -28,6 +58,49 @@ func DecodeOnSuccess(resp *http.Response) bool {
 	return 200 <= resp.StatusCode && resp.StatusCode <= 299
 }
 
+// DecodeOnCodes returns a SuccessDecider decoding the responses with one of
+// codes as success, e.g. DecodeOnCodes(200, 304) for conditional requests.
+func DecodeOnCodes(codes ...int) SuccessDecider {
+	success := make(map[int]bool, len(codes))
+	for _, code := range codes {
+		success[code] = true
+	}
+	return func(resp *http.Response) bool {
+		return success[resp.StatusCode]
+	}
+}
+
+// DecodeOnRange returns a SuccessDecider decoding the responses with a code
+// between min and max, both inclusive, as success.
+func DecodeOnRange(min, max int) SuccessDecider {
+	return func(resp *http.Response) bool {
+		return min <= resp.StatusCode && resp.StatusCode <= max
+	}
+}
+
+// JSONRPCSuccessDecider is DecodeOnSuccess, except that a 2xx response whose
+// JSON-RPC body carries a non-null "error" member is decoded as a failure.
+// The body is buffered and restored so it can still be decoded.
+func JSONRPCSuccessDecider(resp *http.Response) bool {
+	if !DecodeOnSuccess(resp) {
+		return false
+	}
+	body, err := io.ReadAll(resp.Body)
+	// the original body is still drained and closed by Do
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return true
+	}
+
+	var envelope struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return true
+	}
+	return len(envelope.Error) == 0 || string(envelope.Error) == "null"
+}
+
 // ResponseDecoder decodes http responses into struct values.
 type ResponseDecoder interface {
 	// Decode decodes the response into the value pointed to by v.
@@ -38,10 +111,115 @@ type ResponseDecoder interface {
 type jsonDecoder struct {
 }
 
-// Decode decodes the Response Body into the value pointed to by v.
+// Decode decodes the Response Body into the value pointed to by v, converting
+// it to UTF-8 first when the Content-Type names another charset. HTML and
+// XML bodies, such as the error pages of proxies, fail with
+// ErrNonJSONResponse.
 // Caller must provide a non-nil v and close the resp.Body.
 func (d jsonDecoder) Decode(resp *http.Response, v interface{}) error {
-	return json.NewDecoder(resp.Body).Decode(v)
+	body, err := utf8Body(resp)
+	if err != nil {
+		return err
+	}
+	br := bufio.NewReader(body)
+	if err := checkNotMarkup(resp, br); err != nil {
+		return err
+	}
+	return json.NewDecoder(br).Decode(v)
+}
+
+// decodeSnippetLen is the length of the body snippet kept in a DecodeError.
+const decodeSnippetLen = 512
+
+// DecodeError is returned by Receive when the body of a response cannot be
+// decoded, with what is needed to tell why: the status, the Content-Type
+// and the start of the body read by the decoder.
+type DecodeError struct {
+	StatusCode  int
+	ContentType string
+	// Body is the start of the body read before the failure, at most
+	// decodeSnippetLen bytes.
+	Body []byte
+	Err  error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("decode response: status %d, content-type %q: %v: %q", e.StatusCode, e.ContentType, e.Err, e.Body)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// snippetReader reads r, keeping a copy of the first decodeSnippetLen bytes
+// read. Only the start is kept so that large bodies are never buffered.
+type snippetReader struct {
+	r       io.Reader
+	snippet []byte
+}
+
+func (r *snippetReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if keep := min(n, decodeSnippetLen-len(r.snippet)); keep > 0 {
+		r.snippet = append(r.snippet, p[:keep]...)
+	}
+	return n, err
+}
+
+// decode decodes the body of resp into v with decoder, failing with a
+// *DecodeError.
+func decode(decoder ResponseDecoder, resp *http.Response, v interface{}) error {
+	body := resp.Body
+	reader := &snippetReader{r: body}
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{reader, body}
+	defer func() {
+		resp.Body = body
+	}()
+	if err := decoder.Decode(resp, v); err != nil {
+		return &DecodeError{
+			StatusCode:  resp.StatusCode,
+			ContentType: resp.Header.Get(hdrContentTypeKey),
+			Body:        reader.snippet,
+			Err:         err,
+		}
+	}
+	return nil
+}
+
+// nonJSONSnippetLen is the length of the body snippet in ErrNonJSONResponse
+// errors.
+const nonJSONSnippetLen = 200
+
+// checkNotMarkup returns ErrNonJSONResponse with the status code and the
+// start of the body when it starts with '<'.
+func checkNotMarkup(resp *http.Response, br *bufio.Reader) error {
+	peeked, _ := br.Peek(512)
+	trimmed := bytes.TrimLeft(peeked, " \t\r\n")
+	if len(trimmed) == 0 || trimmed[0] != '<' {
+		return nil
+	}
+	snippet := trimmed[:min(len(trimmed), nonJSONSnippetLen)]
+	return fmt.Errorf("%w: status %d: %s", ErrNonJSONResponse, resp.StatusCode, snippet)
+}
+
+// utf8Body returns the body of resp decoded from the charset parameter of its
+// Content-Type. UTF-8 is assumed when there is none.
+func utf8Body(resp *http.Response) (io.Reader, error) {
+	_, params, err := mime.ParseMediaType(resp.Header.Get(hdrContentTypeKey))
+	if err != nil || params["charset"] == "" {
+		return resp.Body, nil
+	}
+	enc, err := htmlindex.Get(params["charset"])
+	if err != nil {
+		return nil, fmt.Errorf("unsupported charset %q: %w", params["charset"], err)
+	}
+	if enc == unicode.UTF8 {
+		return resp.Body, nil
+	}
+	return transform.NewReader(resp.Body, enc.NewDecoder()), nil
 }
 
 type xmlDecoder struct {
@@ -50,3 +228,45 @@ type xmlDecoder struct {
 func (d xmlDecoder) Decode(resp *http.Response, v interface{}) error {
 	return xml.NewDecoder(resp.Body).Decode(v)
 }
+
+// contentTypeDecoder decodes JSON and XML responses according to their
+// Content-Type. Responses without a known Content-Type are sniffed from their
+// first non-whitespace byte, '{' or '[' for JSON and '<' for XML, and decoded
+// by fallback otherwise.
+type contentTypeDecoder struct {
+	fallback ResponseDecoder
+}
+
+func (d contentTypeDecoder) Decode(resp *http.Response, v interface{}) error {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get(hdrContentTypeKey))
+	switch {
+	case mediaType == "application/json" || mediaType == "text/json" || strings.HasSuffix(mediaType, "+json"):
+		return jsonDecoder{}.Decode(resp, v)
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		return xmlDecoder{}.Decode(resp, v)
+	}
+
+	body := bufio.NewReader(resp.Body)
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{body, resp.Body}
+	for {
+		b, err := body.Peek(1)
+		if err != nil {
+			// empty body, left to the fallback decoder
+			return d.fallback.Decode(resp, v)
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			body.Discard(1)
+			continue
+		case '{', '[':
+			return jsonDecoder{}.Decode(resp, v)
+		case '<':
+			return xmlDecoder{}.Decode(resp, v)
+		default:
+			return d.fallback.Decode(resp, v)
+		}
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"context"
 	crand "crypto/rand"
 	"crypto/x509"
+	"errors"
 	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 	"io"
 	"io/ioutil"
@@ -15,6 +17,7 @@ import (
 	"net/url"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -25,7 +28,7 @@ var (
 	defaultRetryMax     = 4
 
 	// We need to consume response bodies to maintain http connections, but
-	// limit the size we consume to respReadLimit.
+	// limit the size we consume to respReadLimit by default.
 	respReadLimit = int64(4096)
 
 	// A regular expression to match the error returned by net/http when the
@@ -74,9 +77,22 @@ type RetryDoer struct {
 	// Backoff specifies the policy for how long to wait between retries
 	Backoff Backoff
 
+	// JitterSource, if set, draws the jitter of the JitterBackoff given to
+	// WithJitterBackoff in [0, 1) instead of crypto/rand, see
+	// WithJitterSource.
+	JitterSource func() float64
+
 	// ErrorHandler specifies the custom error handler to use, if any
 	ErrorHandler ErrorHandler
 
+	// DrainLimit is the number of bytes of a response body read before
+	// retrying, see WithDrainLimit.
+	DrainLimit int64
+
+	// AttemptsVec, if set, observes the number of attempts of each request,
+	// see NapRetryAttemptsVec.
+	AttemptsVec *prometheus.HistogramVec
+
 	log *zap.Logger
 }
 
@@ -110,6 +126,66 @@ func WithRetryBackoff(backoff Backoff) RetryOption {
 	}
 }
 
+// WithJitterBackoff makes the RetryDoer wait between attempts with backoff,
+// drawing its jitter from the JitterSource of the RetryDoer whatever the
+// option order.
+func WithJitterBackoff(backoff JitterBackoff) RetryOption {
+	return func(doer *RetryDoer) {
+		doer.Backoff = func(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
+			return backoff(min, max, attemptNum, resp, doer.JitterSource)
+		}
+	}
+}
+
+// WithExponentialJitterBackoff makes the RetryDoer wait between attempts
+// with ExponentialJitter.
+func WithExponentialJitterBackoff() RetryOption {
+	return WithJitterBackoff(ExponentialJitter)
+}
+
+// WithRetryErrorHandler sets the handler called once retries are exhausted,
+// with the last response and error and the number of attempts made. Its
+// results are returned by Do in place of the default "giving up" error. The
+// handler owns the response: it must close its body unless it returns it.
+func WithRetryErrorHandler(handler ErrorHandler) RetryOption {
+	return func(doer *RetryDoer) {
+		doer.ErrorHandler = handler
+	}
+}
+
+// WithDrainLimit sets how many bytes of a failed response body are read
+// before retrying, 4096 by default. Connections are only reused when their
+// body is read to the end, so a limit above the typical error body size of the
+// API saves reconnecting, at the cost of downloading the discarded bodies.
+func WithDrainLimit(n int64) RetryOption {
+	return func(doer *RetryDoer) {
+		if n >= 0 {
+			doer.DrainLimit = n
+		}
+	}
+}
+
+// WithRetryAttemptsVec observes the number of attempts of each request in vec,
+// created by NapRetryAttemptsVec and registered once by the caller.
+func WithRetryAttemptsVec(vec *prometheus.HistogramVec) RetryOption {
+	return func(doer *RetryDoer) {
+		doer.AttemptsVec = vec
+	}
+}
+
+// NapRetryAttemptsVec returns the histogram of attempts made per request,
+// labeled by host and final status code ("error" when no response came back).
+// It is opt-in: unlike NapCounterVec it is not part of parser.Collectors, the
+// parser not retrying its calls, so the caller registers it and passes it to
+// WithRetryAttemptsVec.
+func NapRetryAttemptsVec() *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "nap_retry_attempts",
+		Help:    "Attempts made per request by the retrying client.",
+		Buckets: prometheus.LinearBuckets(1, 1, 10),
+	}, []string{"host", "status_code"})
+}
+
 // NewRetryDoer creates a new Client with default settings.
 func NewRetryDoer(doer Doer, log *zap.Logger, opts ...RetryOption) *RetryDoer {
 	if doer == nil {
@@ -123,6 +199,7 @@ func NewRetryDoer(doer Doer, log *zap.Logger, opts ...RetryOption) *RetryDoer {
 		RetryMax:     defaultRetryMax,
 		CheckRetry:   DefaultRetryPolicy,
 		Backoff:      DefaultBackoff,
+		DrainLimit:   respReadLimit,
 		log:          log,
 	}
 
@@ -222,24 +299,60 @@ func ErrorPropagatedRetryPolicy(ctx context.Context, resp *http.Response, err er
 	return false, nil
 }
 
+// IdempotencyKeyRetryPolicy is DefaultRetryPolicy for idempotent methods.
+// POST and PATCH requests, which may have been processed before their
+// connection failed or their 5xx response, are only retried when they carry
+// an Idempotency-Key header, the server then processing them once whatever
+// the attempts, see Rest.IdempotencyKey. Without it, they are only retried on
+// 429 Too Many Requests, which the server did not process.
+func IdempotencyKeyRetryPolicy(ctx context.Context, resp *http.Response, err error) (bool, error) {
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+	method := ""
+	var urlErr *url.Error
+	switch {
+	case resp != nil && resp.Request != nil:
+		method = resp.Request.Method
+	case errors.As(err, &urlErr):
+		method = strings.ToUpper(urlErr.Op)
+	}
+	if (method == http.MethodPost || method == http.MethodPatch) && !hasIdempotencyKey(ctx, resp) {
+		return resp != nil && resp.StatusCode == http.StatusTooManyRequests, nil
+	}
+	return DefaultRetryPolicy(ctx, resp, err)
+}
+
+type idempotencyKeyKey struct{}
+
+// hasIdempotencyKey reports whether the request of ctx or resp carries an
+// Idempotency-Key header.
+func hasIdempotencyKey(ctx context.Context, resp *http.Response) bool {
+	if key, _ := ctx.Value(idempotencyKeyKey{}).(string); key != "" {
+		return true
+	}
+	return resp != nil && resp.Request != nil && resp.Request.Header.Get(hdrIdempotencyKey) != ""
+}
+
 // DefaultBackoff provides a default callback for Client.Backoff which
 // will perform exponential backoff based on the attempt number and limited
 // by the provided minimum and maximum durations.
 //
-// It also tries to parse Retry-After response header when a http.StatusTooManyRequests
-// (HTTP Code 429) is found in the resp parameter. Hence it will return the number of
-// seconds the server states it may be ready to process more requests from this client.
+// It also honors the Retry-After header of resp, whatever its status, e.g. on
+// 429 Too Many Requests or 503 Service Unavailable: it then returns the delay
+// the server asks for, limited by the maximum duration.
 func DefaultBackoff(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
-	if resp != nil {
-		if resp.StatusCode == http.StatusTooManyRequests {
-			if s, ok := resp.Header["Retry-After"]; ok {
-				if sleep, err := strconv.ParseInt(s[0], 10, 64); err == nil {
-					return time.Second * time.Duration(sleep)
-				}
-			}
+	if sleep, ok := retryAfter(resp); ok {
+		if sleep > max {
+			sleep = max
 		}
+		return sleep
 	}
+	return exponentialBackoff(min, max, attemptNum)
+}
 
+// exponentialBackoff returns min*2^attemptNum, limited by max.
+func exponentialBackoff(min, max time.Duration, attemptNum int) time.Duration {
 	mult := math.Pow(2, float64(attemptNum)) * float64(min)
 	sleep := time.Duration(mult)
 	if float64(sleep) != mult || sleep > max {
@@ -248,13 +361,89 @@ func DefaultBackoff(min, max time.Duration, attemptNum int, resp *http.Response)
 	return sleep
 }
 
+// ExponentialJitterBackoff provides a callback for Client.Backoff which will
+// perform exponential backoff with full jitter: the wait is drawn at random
+// between zero and min*2^attemptNum, limited by max. Like DefaultBackoff, it
+// honors the Retry-After header of resp.
+//
+// Prefer it over DefaultBackoff when many clients retry against the same
+// server, e.g. after an outage, since spreading their retries avoids them
+// hitting it again all at once; and over LinearJitterBackoff when the server
+// needs increasingly long to recover.
+func ExponentialJitterBackoff(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
+	return ExponentialJitter(min, max, attemptNum, resp, nil)
+}
+
+// ExponentialJitter is ExponentialJitterBackoff drawing its jitter from
+// random.
+func ExponentialJitter(min, max time.Duration, attemptNum int, resp *http.Response, random func() float64) time.Duration {
+	if sleep, ok := retryAfter(resp); ok {
+		if sleep > max {
+			sleep = max
+		}
+		return sleep
+	}
+	return exponentialJitterBackoff(min, max, attemptNum, jitterSource(random))
+}
+
+func exponentialJitterBackoff(min, max time.Duration, attemptNum int, random func() (float64, error)) time.Duration {
+	ceiling := exponentialBackoff(min, max, attemptNum)
+	randedF, err := random()
+	if err != nil {
+		return ceiling
+	}
+	return time.Duration(randedF * float64(ceiling))
+}
+
+// retryAfter returns the delay of the Retry-After header of resp, given in
+// seconds or as an HTTP date, and false when it is missing or invalid.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return scaleDuration(float64(time.Second), int(seconds)), true
+	}
+	at, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	return max(time.Until(at), 0), true
+}
+
+// JitterBackoff is a Backoff drawing its jitter from random, returning
+// values in [0, 1), or from crypto/rand when random is nil. See
+// WithJitterBackoff.
+type JitterBackoff func(min, max time.Duration, attemptNum int, resp *http.Response, random func() float64) time.Duration
+
+// jitterSource returns random as the source of the jitter backoffs,
+// randomFloat when nil.
+func jitterSource(random func() float64) func() (float64, error) {
+	if random == nil {
+		return randomFloat
+	}
+	return func() (float64, error) {
+		return random(), nil
+	}
+}
+
+// randomFloat returns a random number in [0, 1).
 func randomFloat() (float64, error) {
-	maxInt := ^int64(0)
+	// 53 bits, the precision of a float64, so that the quotient never
+	// rounds up to 1
+	const maxInt = 1 << 53
 	randed, err := crand.Int(crand.Reader, big.NewInt(maxInt))
 	if err != nil {
 		return 0, err
 	}
-	randedF := float64(randed.Int64()) / float64(maxInt)
+	randedF := float64(randed.Int64()) / maxInt
 
 	return randedF, nil
 }
@@ -276,27 +465,54 @@ func randomFloat() (float64, error) {
 // * To get extreme jitter, set to a very wide spread, such as a min of 100ms
 // and a max of 20s (15382ms, 292ms, 51321ms, 35234ms, ...)
 func LinearJitterBackoff(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
+	return LinearJitter(min, max, attemptNum, resp, nil)
+}
+
+// LinearJitter is LinearJitterBackoff drawing its jitter from random.
+func LinearJitter(min, max time.Duration, attemptNum int, resp *http.Response, random func() float64) time.Duration {
+	return linearJitterBackoff(min, max, attemptNum, jitterSource(random))
+}
+
+// WithJitterSource makes the JitterBackoff given to WithJitterBackoff draw
+// its jitter from fn, returning values in [0, 1), instead of crypto/rand. It
+// makes retry timing deterministic in tests and cheaper under high
+// throughput. Backoffs set otherwise, e.g. with WithRetryBackoff, ignore it.
+func WithJitterSource(fn func() float64) RetryOption {
+	return func(doer *RetryDoer) {
+		doer.JitterSource = fn
+	}
+}
+
+func linearJitterBackoff(min, max time.Duration, attemptNum int, random func() (float64, error)) time.Duration {
 	// attemptNum always starts at zero but we want to start at 1 for multiplication
 	attemptNum++
 
 	if max <= min {
 		// Unclear what to do here, or they are the same, so return min *
 		// attemptNum
-		return min * time.Duration(attemptNum)
+		return scaleDuration(float64(min), attemptNum)
 	}
 
-	randedF, err := randomFloat()
+	randedF, err := random()
 	if err != nil {
-		return min * time.Duration(attemptNum)
+		return scaleDuration(float64(min), attemptNum)
 	}
-	// Seed rand; doing this every time is fine
 	// Pick a random number that lies somewhere between the min and max and
 	// multiply by the attemptNum. attemptNum starts at zero so we always
 	// increment here. We first get a random percentage, then apply that to the
 	// difference between min and max, and add to min.
 	jitter := randedF * float64(max-min)
-	jitterMin := int64(jitter) + int64(min)
-	return time.Duration(jitterMin * int64(attemptNum))
+	return scaleDuration(jitter+float64(min), attemptNum)
+}
+
+// scaleDuration returns d*n, capped to the longest time.Duration instead of
+// overflowing.
+func scaleDuration(d float64, n int) time.Duration {
+	scaled := d * float64(n)
+	if scaled >= math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(scaled)
 }
 
 // ReaderFunc is the type of function that can be given natively to NewRequest
@@ -375,10 +591,21 @@ func (c *RetryDoer) Do(req *http.Request) (*http.Response, error) {
 	return c.DoCustom(re)
 }
 
+func (c *RetryDoer) observeAttempts(req *Request, code, attempts int) {
+	if c.AttemptsVec == nil || attempts == 0 {
+		return
+	}
+	status := "error"
+	if code > 0 {
+		status = strconv.Itoa(code)
+	}
+	c.AttemptsVec.WithLabelValues(req.URL.Host, status).Observe(float64(attempts))
+}
+
 // Try to read the response body so we can reuse this connection.
 func (c *RetryDoer) drainBody(body io.ReadCloser) error {
 	defer body.Close()
-	_, err := io.Copy(ioutil.Discard, io.LimitReader(body, respReadLimit))
+	_, err := io.Copy(ioutil.Discard, io.LimitReader(body, c.DrainLimit))
 	return err
 }
 
@@ -388,13 +615,16 @@ func (c *RetryDoer) DoCustom(req *Request) (*http.Response, error) {
 
 	var resp *http.Response
 	var attempt int
+	var code int // HTTP response code of the last attempt
 	var shouldRetry bool
 	var doErr, checkErr error
+	defer func() {
+		c.observeAttempts(req, code, attempt)
+	}()
 
 	for i := 0; ; i++ {
 		attempt++
-
-		var code int // HTTP response code
+		code = 0
 
 		// Always rewind the request body when non-nil.
 		if err := req.rewind(); err != nil {
@@ -447,6 +677,8 @@ func (c *RetryDoer) DoCustom(req *Request) (*http.Response, error) {
 
 		// Make shallow copy of http Request so that we can modify its body
 		// without racing against the closeBody call in persistConn.writeLoop.
+		// The copy keeps the context of the request, so its values, such as
+		// otel spans, and its deadline apply to every attempt.
 		httpreq := *req.Request
 		req.Request = &httpreq
 	}
@@ -0,0 +1,63 @@
+package rest
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+type metricRouteKey struct{}
+
+// WithMetricRoute returns a copy of ctx labeling the requests made with it
+// by route, a low-cardinality name such as "/blocks/{hash}" or a JSON-RPC
+// method, in the path label of the counter. It takes precedence over
+// MetricRoute.
+func WithMetricRoute(ctx context.Context, route string) context.Context {
+	return context.WithValue(ctx, metricRouteKey{}, route)
+}
+
+// MetricRoute labels the requests built by s by route in the path label of
+// the counter, see WithMetricRoute.
+func (s *Rest) MetricRoute(route string) *Rest {
+	s.metricRoute = route
+	return s
+}
+
+// metricPath returns the path label of a request to rawURL made with ctx:
+// its route when set, otherwise the URL path with identifier-like segments
+// replaced by "{id}" and the query dropped.
+func (s *Rest) metricPath(ctx context.Context) string {
+	if route, ok := ctx.Value(metricRouteKey{}).(string); ok && route != "" {
+		return route
+	}
+	if s.metricRoute != "" {
+		return s.metricRoute
+	}
+	return sanitizePath(s.rawURL)
+}
+
+func sanitizePath(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	segments := strings.Split(u.Path, "/")
+	for i, segment := range segments {
+		if isIdentifier(segment) {
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// isIdentifier reports whether a path segment looks like a number, a hex
+// hash or another long opaque value.
+func isIdentifier(segment string) bool {
+	if segment == "" {
+		return false
+	}
+	if strings.HasPrefix(segment, "0x") || strings.HasPrefix(segment, "0X") || len(segment) >= 32 {
+		return true
+	}
+	return strings.Trim(segment, "0123456789") == ""
+}
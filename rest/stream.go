@@ -0,0 +1,218 @@
+package rest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrUnexpectedStatus is returned by the streaming receives when the
+	// server answers with a non-2xx status.
+	ErrUnexpectedStatus = errors.New("unexpected response status")
+	// ErrStreamInterrupted is returned by the streaming receives, along with
+	// io.ErrUnexpectedEOF, when the connection drops before the body ends.
+	ErrStreamInterrupted = errors.New("stream interrupted")
+)
+
+// StreamOption configures ReceiveSSE.
+type StreamOption func(c *streamConfig)
+
+type streamConfig struct {
+	backoff Backoff
+	waitMin time.Duration
+	waitMax time.Duration
+}
+
+// WithAutoReconnect makes ReceiveSSE reconnect whenever the stream ends or
+// the connection fails, waiting backoff(1s, 30s, attempt, nil) in between;
+// a retry field sent by the server replaces the minimum. Reconnections send
+// the Last-Event-ID of the last event received so that the server can
+// resume from there. Attempts count from zero again after each event.
+func WithAutoReconnect(backoff Backoff) StreamOption {
+	return func(c *streamConfig) {
+		c.backoff = backoff
+	}
+}
+
+// Event is a Server-Sent Event. Event is empty for the default "message"
+// type.
+type Event struct {
+	ID    string
+	Event string
+	Data  string
+	// Retry is the reconnection delay requested by the server, if any.
+	Retry time.Duration
+}
+
+// ReceiveLines sends the request bound to ctx and calls fn with each line of
+// the response body as soon as it arrives, e.g. for NDJSON streams. Lines
+// are passed without their end of line, empty ones are skipped, and the
+// slice is only valid until fn returns. It returns once the body ends, fn
+// fails, or ctx is done, in which case the body is closed to unblock the
+// pending read and ctx.Err() is returned.
+func (s *Rest) ReceiveLines(ctx context.Context, fn func(line []byte) error) (*Response, error) {
+	return s.stream(ctx, func(r *bufio.Reader) error {
+		return readLines(r, func(line []byte) error {
+			if len(line) == 0 {
+				return nil
+			}
+			return fn(line)
+		})
+	})
+}
+
+// ReceiveSSE is ReceiveLines for text/event-stream responses, calling fn
+// with each event as soon as it is complete. It returns when the stream
+// ends, unless WithAutoReconnect is given; a 204 No Content response always
+// ends it. The Accept and Last-Event-ID headers are set on a clone, leaving s
+// untouched.
+func (s *Rest) ReceiveSSE(ctx context.Context, fn func(event Event) error, opts ...StreamOption) (*Response, error) {
+	c := streamConfig{waitMin: defaultRetryWaitMin, waitMax: defaultRetryWaitMax}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	stream := s.Clone().SetHeader("Accept", "text/event-stream")
+
+	var lastID string
+	var retry time.Duration
+	for attempt := 0; ; attempt++ {
+		if lastID != "" {
+			stream.SetHeader("Last-Event-ID", lastID)
+		}
+		var fnErr error
+		resp, err := stream.stream(ctx, func(r *bufio.Reader) error {
+			return readEvents(r, func(event Event) error {
+				attempt = 0
+				lastID = event.ID
+				if event.Retry > 0 {
+					retry = event.Retry
+				}
+				fnErr = fn(event)
+				return fnErr
+			})
+		})
+		if c.backoff == nil || fnErr != nil || !reconnectable(ctx, resp, err) {
+			return resp, err
+		}
+
+		wait := c.backoff(max(c.waitMin, retry), c.waitMax, attempt, nil)
+		select {
+		case <-ctx.Done():
+			return resp, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// reconnectable reports whether a stream that ended with resp and err may be
+// received again.
+func reconnectable(ctx context.Context, resp *Response, err error) bool {
+	if ctx.Err() != nil || (resp != nil && resp.StatusCode == http.StatusNoContent) {
+		return false
+	}
+	var urlErr *url.Error
+	return err == nil || errors.Is(err, ErrStreamInterrupted) || errors.As(err, &urlErr)
+}
+
+// readEvents calls fn with each event read from r.
+func readEvents(r *bufio.Reader, fn func(event Event) error) error {
+	var event Event
+	var data []string
+	return readLines(r, func(line []byte) error {
+		if len(line) == 0 {
+			// a blank line dispatches the event
+			if data == nil {
+				return nil
+			}
+			event.Data = strings.Join(data, "\n")
+			err := fn(event)
+			event, data = Event{ID: event.ID}, nil
+			return err
+		}
+		field, value, _ := strings.Cut(string(line), ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "":
+			// comment
+		case "id":
+			event.ID = value
+		case "event":
+			event.Event = value
+		case "data":
+			data = append(data, value)
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil {
+				event.Retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+		return nil
+	})
+}
+
+// stream sends the request bound to ctx and hands the body of a 2xx response
+// to read. The success decider is not used, as it could wait for the whole
+// body.
+func (s *Rest) stream(ctx context.Context, read func(r *bufio.Reader) error) (*Response, error) {
+	req, err := s.request(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.recorder.record(req); err != nil {
+		return nil, err
+	}
+	requestURL := *req.URL
+	start := time.Now()
+	resp, err := s.httpClient.Do(req)
+	response := NewResponse(resp)
+	response.Duration = response.ReceivedAt.Sub(start)
+	response.requestURL = &requestURL
+	if err != nil {
+		return response, err
+	}
+	defer resp.Body.Close()
+
+	if !DecodeOnSuccess(resp) {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, nonJSONSnippetLen))
+		return response, fmt.Errorf("%w: %s: %s", ErrUnexpectedStatus, resp.Status, body)
+	}
+
+	// a Read blocked on a silent server only returns once the body is closed
+	stop := context.AfterFunc(ctx, func() {
+		resp.Body.Close()
+	})
+	defer stop()
+	err = read(bufio.NewReader(resp.Body))
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return response, ctxErr
+	}
+	return response, err
+}
+
+// readLines calls fn with each line read from r, without its end of line.
+// Read errors other than the end of the body are ErrStreamInterrupted.
+func readLines(r *bufio.Reader, fn func(line []byte) error) error {
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) && len(line) == 0 {
+			return nil
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return fmt.Errorf("%w: %w", ErrStreamInterrupted, err)
+			}
+			return fmt.Errorf("%w: %w: %v", ErrStreamInterrupted, io.ErrUnexpectedEOF, err)
+		}
+		if fnErr := fn(bytes.TrimRight(line, "\r\n")); fnErr != nil {
+			return fnErr
+		}
+	}
+}
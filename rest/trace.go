@@ -0,0 +1,43 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type (
+	noTraceKey        struct{}
+	spanAttributesKey struct{}
+)
+
+// SpanAttributesFunc returns the attributes describing req, see
+// WithSpanAttributes.
+type SpanAttributesFunc func(req *http.Request) []attribute.KeyValue
+
+// WithoutTracing returns a copy of ctx marking the requests built with it as
+// excluded from tracing by the NewOtel transport.
+func WithoutTracing(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noTraceKey{}, true)
+}
+
+// tracingEnabled is the otelhttp filter honoring WithoutTracing.
+func tracingEnabled(req *http.Request) bool {
+	noTrace, _ := req.Context().Value(noTraceKey{}).(bool)
+	return !noTrace
+}
+
+// spanAttributesTransport runs under the otelhttp transport, where the request
+// context holds the span, and adds the attributes of WithSpanAttributes.
+type spanAttributesTransport struct {
+	base http.RoundTripper
+}
+
+func (t spanAttributesTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if fn, ok := req.Context().Value(spanAttributesKey{}).(SpanAttributesFunc); ok {
+		trace.SpanFromContext(req.Context()).SetAttributes(fn(req)...)
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,57 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+// transportError returns err, the failure of the Doer sending req, as a
+// *url.Error like the ones of *http.Client, so that callers can inspect it
+// with errors.As whatever the Doer.
+func transportError(req *http.Request, err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return err
+	}
+	op := req.Method
+	if op != "" {
+		op = op[:1] + strings.ToLower(op[1:])
+	}
+	return &url.Error{Op: op, URL: req.URL.String(), Err: err}
+}
+
+// IsTimeout reports whether err is a request timing out, either its context
+// deadline or a network timeout.
+func IsTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// IsConnError reports whether err is a failure to reach the server or a
+// connection lost before the response, as opposed to a timeout, a
+// cancellation or an error response.
+func IsConnError(err error) bool {
+	if err == nil || IsTimeout(err) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	switch {
+	case errors.As(err, &opErr), errors.As(err, &dnsErr):
+		return true
+	case errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET):
+		return true
+	default:
+		// the server closed the connection without answering
+		return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+	}
+}
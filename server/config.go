@@ -0,0 +1,101 @@
+package server
+
+import (
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+type config struct {
+	// authenticators guarding the non-public routes, none means open access
+	authenticators []authenticator
+	// API keys accepted by WithAPIKeyAuth, also keying the rate limiter
+	apiKeys []string
+	// paths served without authentication nor rate limiting
+	publicPaths map[string]bool
+	// per-client rate limiter, nil means unlimited
+	rateLimiter *rateLimiter
+	// logger shared with the rest of the process
+	logger *zap.Logger
+}
+
+type Option interface {
+	apply(*config)
+}
+
+type optionFunc func(*config)
+
+func (o optionFunc) apply(c *config) {
+	o(c)
+}
+
+func newConfig(opts ...Option) *config {
+	c := &config{
+		publicPaths: map[string]bool{
+			"/healthz": true,
+			"/readyz":  true,
+			"/metrics": true,
+		},
+	}
+	for _, opt := range opts {
+		opt.apply(c)
+	}
+
+	return c
+}
+
+// WithAPIKeyAuth requires requests to carry one of keys in the X-API-Key
+// header.
+func WithAPIKeyAuth(keys ...string) Option {
+	return optionFunc(func(c *config) {
+		if len(keys) > 0 {
+			c.authenticators = append(c.authenticators, apiKeyAuthenticator(keys))
+			c.apiKeys = append(c.apiKeys, keys...)
+		}
+	})
+}
+
+// WithBearerAuth requires requests to carry a bearer token accepted by
+// validator in the Authorization header.
+func WithBearerAuth(validator func(token string) (bool, error)) Option {
+	return optionFunc(func(c *config) {
+		if validator != nil {
+			c.authenticators = append(c.authenticators, bearerAuthenticator(validator))
+		}
+	})
+}
+
+// WithLogger makes the server log through logger instead of its own.
+func WithLogger(logger *zap.Logger) Option {
+	return optionFunc(func(c *config) {
+		if logger != nil {
+			c.logger = logger
+		}
+	})
+}
+
+// WithRateLimit allows each client, identified by its X-API-Key header when it
+// is one of the keys of WithAPIKeyAuth and by its IP otherwise, rps requests
+// per second with bursts of up to burst requests. A non-positive rps disables
+// rate limiting.
+func WithRateLimit(rps float64, burst int) Option {
+	return optionFunc(func(c *config) {
+		if rps <= 0 {
+			c.rateLimiter = nil
+			return
+		}
+		if burst < 1 {
+			burst = 1
+		}
+		c.rateLimiter = newRateLimiter(rate.Limit(rps), burst)
+	})
+}
+
+// WithPublicPaths serves paths without authentication nor rate limiting, in
+// addition to the health and metrics endpoints.
+func WithPublicPaths(paths ...string) Option {
+	return optionFunc(func(c *config) {
+		for _, path := range paths {
+			c.publicPaths[path] = true
+		}
+	})
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/dungnh3/trustwallet-assignment/internal/parser"
+	"github.com/dungnh3/trustwallet-assignment/internal/utils"
+	"go.uber.org/zap"
+)
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+type statusResponse struct {
+	Status string `json:"status"`
+}
+
+// readyResponse is the answer of a ready parser, with its status.
+type readyResponse struct {
+	Status string              `json:"status"`
+	Parser parser.ParserStatus `json:"parser"`
+}
+
+type blockResponse struct {
+	Block int `json:"block"`
+}
+
+type transactionsResponse struct {
+	Address      string               `json:"address"`
+	Transactions []parser.Transaction `json:"transactions"`
+	NextCursor   int                  `json:"next_cursor,omitempty"`
+}
+
+type subscribeRequest struct {
+	Address string `json:"address"`
+	// FromBlock, when set, backfills the address from that block.
+	FromBlock *int `json:"from_block,omitempty"`
+}
+
+type subscribeResponse struct {
+	Address    string `json:"address"`
+	Subscribed bool   `json:"subscribed"`
+}
+
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, http.StatusOK, statusResponse{Status: "ok"})
+}
+
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+	if err := s.parser.Ping(ctx); err != nil {
+		s.logger.Warn("rpc node is not reachable", zap.Error(err))
+		s.writeError(w, http.StatusServiceUnavailable, "rpc node is not reachable: "+err.Error())
+		return
+	}
+	s.writeJSON(w, http.StatusOK, readyResponse{Status: "ok", Parser: s.parser.Status()})
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, http.StatusOK, s.parser.Status())
+}
+
+func (s *Server) handleGetBlock(w http.ResponseWriter, r *http.Request) {
+	block, err := s.parser.CurrentBlockContext(r.Context())
+	if err != nil {
+		s.logger.Error("failed to fetch current block", zap.Error(err))
+		s.writeError(w, http.StatusBadGateway, "failed to fetch current block")
+		return
+	}
+	s.writeJSON(w, http.StatusOK, blockResponse{Block: block})
+}
+
+func (s *Server) handleGetTransactions(w http.ResponseWriter, r *http.Request) {
+	address := r.URL.Query().Get("address")
+	if !utils.IsHexAddress(address) {
+		s.writeError(w, http.StatusBadRequest, "invalid address")
+		return
+	}
+	q, err := transactionQuery(r.URL.Query())
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	page, err := s.parser.GetTransactionsFilteredContext(r.Context(), address, q)
+	if errors.Is(err, parser.ErrInvalidQuery) {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		s.logger.Error("failed to fetch transactions", zap.String("address", address), zap.Error(err))
+		s.writeError(w, http.StatusBadGateway, "failed to fetch transactions")
+		return
+	}
+	transactions := page.Transactions
+	if transactions == nil {
+		transactions = []parser.Transaction{}
+	}
+	s.writeJSON(w, http.StatusOK, transactionsResponse{
+		Address:      address,
+		Transactions: transactions,
+		NextCursor:   page.NextCursor,
+	})
+}
+
+// transactionQuery reads the direction, limit, offset, cursor, since and
+// until parameters of a transactions request.
+func transactionQuery(values url.Values) (parser.TransactionQuery, error) {
+	q := parser.TransactionQuery{Direction: parser.Direction(values.Get("direction"))}
+	for name, dst := range map[string]*int{"limit": &q.Limit, "offset": &q.Offset, "cursor": &q.Cursor} {
+		if value := values.Get(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return q, fmt.Errorf("invalid %s", name)
+			}
+			*dst = n
+		}
+	}
+	for name, dst := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		if value := values.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return q, fmt.Errorf("invalid %s", name)
+			}
+			*dst = t
+		}
+	}
+	return q, nil
+}
+
+func (s *Server) handleSubscribe(w http.ResponseWriter, r *http.Request) {
+	var req subscribeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if !utils.IsHexAddress(req.Address) {
+		s.writeError(w, http.StatusBadRequest, "invalid address")
+		return
+	}
+	var subscribed bool
+	if req.FromBlock != nil {
+		if *req.FromBlock < 0 {
+			s.writeError(w, http.StatusBadRequest, "invalid from_block")
+			return
+		}
+		subscribed = s.parser.SubscribeFromBlock(req.Address, *req.FromBlock)
+	} else {
+		subscribed = s.parser.Subscribe(req.Address)
+	}
+	s.writeJSON(w, http.StatusOK, subscribeResponse{Address: req.Address, Subscribed: subscribed})
+}
+
+func (s *Server) handleUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	address := r.URL.Query().Get("address")
+	if !utils.IsHexAddress(address) {
+		s.writeError(w, http.StatusBadRequest, "invalid address")
+		return
+	}
+	if !s.parser.Unsubscribe(address) {
+		s.writeError(w, http.StatusNotFound, "address is not subscribed")
+		return
+	}
+	s.writeJSON(w, http.StatusOK, subscribeResponse{Address: address, Subscribed: false})
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.logger.Error("failed to write response", zap.Error(err))
+	}
+}
+
+func (s *Server) writeError(w http.ResponseWriter, status int, msg string) {
+	s.writeJSON(w, status, errorResponse{Error: msg})
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/dungnh3/trustwallet-assignment/rest"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	hdrRequestIDKey = "X-Request-ID"
+	// maxRequestIDLen bounds the ids accepted from clients.
+	maxRequestIDLen = 128
+)
+
+// responseRecorder captures the status and size of a response. It keeps the
+// Flusher and Hijacker of the wrapped writer available for streams.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+func (r *responseRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking is not supported")
+	}
+	if r.status == 0 {
+		r.status = http.StatusSwitchingProtocols
+	}
+	return h.Hijack()
+}
+
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// loggingMiddleware tags each request with a correlation id, echoed in the
+// X-Request-ID header and carried by the request context, logs it once
+// served, and turns handler panics into 500 responses.
+func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(hdrRequestIDKey)
+		if id == "" || len(id) > maxRequestIDLen {
+			id = uuid.New().String()
+		}
+		w.Header().Set(hdrRequestIDKey, id)
+		r = r.WithContext(rest.WithRequestID(r.Context(), id))
+		rec := &responseRecorder{ResponseWriter: w}
+		logger := s.logger.With(zap.String("request_id", id))
+
+		defer func() {
+			if p := recover(); p != nil {
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				logger.Error("panic while serving request",
+					zap.String("method", r.Method),
+					zap.String("path", r.URL.Path),
+					zap.Any("panic", p),
+					zap.Stack("stack"))
+				if rec.status == 0 {
+					s.writeError(rec, http.StatusInternalServerError, "internal server error")
+				}
+			}
+			logger.Info("served request",
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+				zap.Int("status", rec.status),
+				zap.Duration("duration", time.Since(start)),
+				zap.Int("bytes", rec.bytes))
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
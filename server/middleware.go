@@ -0,0 +1,69 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// authenticator reports whether r carries valid credentials.
+type authenticator func(r *http.Request) (bool, error)
+
+func apiKeyAuthenticator(keys []string) authenticator {
+	return func(r *http.Request) (bool, error) {
+		return validAPIKey(keys, r.Header.Get("X-API-Key")), nil
+	}
+}
+
+// validAPIKey reports whether key is one of keys, in constant time.
+func validAPIKey(keys []string, key string) bool {
+	if key == "" {
+		return false
+	}
+	valid := false
+	for _, k := range keys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(k)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+func bearerAuthenticator(validator func(token string) (bool, error)) authenticator {
+	return func(r *http.Request) (bool, error) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			return false, nil
+		}
+		return validator(token)
+	}
+}
+
+// authMiddleware rejects requests to non-public paths which none of the
+// configured authenticators accept.
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	if len(s.config.authenticators) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.config.publicPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		for _, authenticate := range s.config.authenticators {
+			ok, err := authenticate(r)
+			if err != nil {
+				s.logger.Error("failed to authenticate request", zap.String("path", r.URL.Path), zap.Error(err))
+				continue
+			}
+			if ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		s.writeError(w, http.StatusUnauthorized, "unauthorized")
+	})
+}
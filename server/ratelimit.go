@@ -0,0 +1,104 @@
+package server
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// limiterIdleTTL is how long the bucket of a silent client is kept.
+const limiterIdleTTL = 10 * time.Minute
+
+type visitor struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// rateLimiter keeps one token bucket per client, keyed by API key when the
+// client sends a valid one and by remote IP otherwise.
+type rateLimiter struct {
+	limit rate.Limit
+	burst int
+
+	mutex     sync.Mutex
+	visitors  map[string]*visitor
+	lastSweep time.Time
+}
+
+func newRateLimiter(limit rate.Limit, burst int) *rateLimiter {
+	return &rateLimiter{
+		limit:     limit,
+		burst:     burst,
+		visitors:  make(map[string]*visitor),
+		lastSweep: time.Now(),
+	}
+}
+
+func (l *rateLimiter) get(key string) *rate.Limiter {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) > limiterIdleTTL {
+		for k, v := range l.visitors {
+			if now.Sub(v.lastSeen) > limiterIdleTTL {
+				delete(l.visitors, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	v, ok := l.visitors[key]
+	if !ok {
+		v = &visitor{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.visitors[key] = v
+	}
+	v.lastSeen = now
+	return v.limiter
+}
+
+// clientKey identifies the client of r. Rate limiting runs before
+// authentication, so an API key is only trusted once checked against the
+// configured ones: otherwise a client could get a fresh bucket on every
+// request by sending a new key.
+func (s *Server) clientKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); validAPIKey(s.config.apiKeys, key) {
+		return "key:" + key
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// rateLimitMiddleware answers 429 with a Retry-After header to clients that
+// exceed their token bucket. Public paths are never limited.
+func (s *Server) rateLimitMiddleware(next http.Handler) http.Handler {
+	if s.config.rateLimiter == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.config.publicPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		reservation := s.config.rateLimiter.get(s.clientKey(r)).Reserve()
+		if !reservation.OK() {
+			s.writeError(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+		if delay := reservation.Delay(); delay > 0 {
+			reservation.Cancel()
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			s.writeError(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/dungnh3/trustwallet-assignment/internal/parser"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+// readyTimeout bounds the RPC round trip done by the readiness probe.
+const readyTimeout = 2 * time.Second
+
+// Server exposes a parser.Parser over HTTP.
+type Server struct {
+	config     *config
+	parser     parser.Parser
+	mux        *http.ServeMux
+	handler    http.Handler
+	httpServer *http.Server
+	logger     *zap.Logger
+	streamSubs streamSubscriptions
+
+	// done is closed when Shutdown starts so long-lived streams, which
+	// Shutdown does not wait for or interrupt, can terminate.
+	done chan struct{}
+}
+
+// New returns a Server with all routes registered against the given parser.
+func New(p parser.Parser, opts ...Option) *Server {
+	c := newConfig(opts...)
+	logger := c.logger
+	if logger == nil {
+		logger, _ = zap.NewProduction()
+	}
+	s := &Server{
+		config: c,
+		parser: p,
+		mux:    http.NewServeMux(),
+		logger: logger,
+		done:   make(chan struct{}),
+	}
+	s.streamSubs.refs = make(map[string]*streamSubscription)
+	s.routes()
+	s.handler = s.loggingMiddleware(s.rateLimitMiddleware(s.authMiddleware(s.mux)))
+	s.httpServer = &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	s.httpServer.RegisterOnShutdown(func() {
+		close(s.done)
+	})
+	return s
+}
+
+func (s *Server) routes() {
+	s.mux.HandleFunc("GET /healthz", s.handleHealthz)
+	s.mux.HandleFunc("GET /readyz", s.handleReadyz)
+	s.mux.Handle("GET /metrics", promhttp.Handler())
+	s.mux.HandleFunc("GET /status", s.handleStatus)
+	s.mux.HandleFunc("GET /block", s.handleGetBlock)
+	s.mux.HandleFunc("GET /transactions", s.handleGetTransactions)
+	s.mux.HandleFunc("POST /subscribe", s.handleSubscribe)
+	s.mux.HandleFunc("DELETE /subscribe", s.handleUnsubscribe)
+	s.mux.HandleFunc("GET /stream", s.handleStream)
+	s.mux.HandleFunc("GET /ws", s.handleWebSocket)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// ListenAndServe listens on the TCP network address addr and serves requests
+// until Shutdown is called.
+func (s *Server) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s.logger.Info("server listening", zap.String("addr", ln.Addr().String()))
+	return s.httpServer.Serve(ln)
+}
+
+// Shutdown gracefully stops the server, waiting for in-flight requests until
+// ctx is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.httpServer.Shutdown(ctx)
+}
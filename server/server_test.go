@@ -0,0 +1,495 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dungnh3/trustwallet-assignment/internal/models"
+	"github.com/dungnh3/trustwallet-assignment/internal/parser"
+	"github.com/dungnh3/trustwallet-assignment/internal/parser/testutil"
+	"github.com/dungnh3/trustwallet-assignment/internal/repositories"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+const testAddress = "0x00000000000000000000000000000000000000ab"
+
+// newTestServer returns a Server backed by a parser of a mock node, whose
+// chain is at block 0x10 without any block mined after it.
+func newTestServer(t *testing.T, opts ...Option) (*Server, *testutil.Server, repositories.Repository) {
+	t.Helper()
+	rpc := testutil.NewServer(t)
+	rpc.Result("eth_blockNumber", "0x10")
+	rpc.Result("eth_getBlockByNumber", nil)
+	s, repo := newParserServer(t, rpc, time.Hour, opts...)
+	return s, rpc, repo
+}
+
+// newParserServer returns a Server backed by a parser of rpc polling every
+// interval.
+func newParserServer(t *testing.T, rpc *testutil.Server, interval time.Duration, opts ...Option) (*Server, repositories.Repository) {
+	t.Helper()
+	repo := repositories.New()
+	p := parser.New(context.Background(), rpc.URL, repo, parser.WithInterval(interval)).(*parser.Invoker)
+	t.Cleanup(func() { p.Close() })
+	return New(p, append([]Option{WithLogger(zap.NewNop())}, opts...)...), repo
+}
+
+// mineBlocks makes rpc mine a block on every eth_blockNumber call, each
+// holding a transaction sent by testAddress with hash 0xaa followed by the
+// block number.
+func mineBlocks(rpc *testutil.Server) {
+	var current atomic.Int64
+	current.Store(0x10)
+	rpc.Handle("eth_blockNumber", func([]json.RawMessage) interface{} { return fmt.Sprintf("%#x", current.Add(1)) })
+	rpc.Handle("eth_getBlockByNumber", func(params []json.RawMessage) interface{} {
+		var number string
+		json.Unmarshal(params[0], &number)
+		return map[string]interface{}{
+			"number":       number,
+			"transactions": []map[string]string{{"hash": "0xaa" + number[2:], "from": testAddress, "to": "0xdef"}},
+		}
+	})
+}
+
+// waitSubscriptions waits until the parser of s has n subscriptions.
+func waitSubscriptions(t *testing.T, s *Server, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for s.parser.Status().ActiveSubscriptions != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d subscriptions, got %d", n, s.parser.Status().ActiveSubscriptions)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// serve sends a request to s and returns the recorded response.
+func serve(s *Server, method, target, body string) *httptest.ResponseRecorder {
+	var req *http.Request
+	if body == "" {
+		req = httptest.NewRequest(method, target, nil)
+	} else {
+		req = httptest.NewRequest(method, target, strings.NewReader(body))
+	}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	return rec
+}
+
+func decodeBody(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.NewDecoder(rec.Body).Decode(v); err != nil {
+		t.Fatalf("invalid response body: %v", err)
+	}
+}
+
+func TestHandleGetBlock(t *testing.T) {
+	s, rpc, _ := newTestServer(t)
+	rec := serve(s, http.MethodGet, "/block", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var resp blockResponse
+	decodeBody(t, rec, &resp)
+	if resp.Block != 16 {
+		t.Errorf("expected block 16, got %d", resp.Block)
+	}
+
+	rpc.Fail("eth_blockNumber", -32000, "unavailable")
+	if rec := serve(s, http.MethodGet, "/block", ""); rec.Code != http.StatusBadGateway {
+		t.Errorf("expected 502 when the node fails, got %d", rec.Code)
+	}
+}
+
+func TestHandleGetTransactions(t *testing.T) {
+	s, rpc, repo := newTestServer(t)
+	rpc.Handle("eth_getTransactionByHash", func(params []json.RawMessage) interface{} {
+		var hash string
+		json.Unmarshal(params[0], &hash)
+		return map[string]string{"hash": hash, "from": testAddress, "to": "0xdef"}
+	})
+	err := repo.CreateBlockTransactions(context.Background(), []*models.BlockTransaction{
+		{BlockAddress: testAddress, TransactionAddress: "0xaa", Direction: string(parser.Outgoing)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serve(s, http.MethodGet, "/transactions?address="+testAddress, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var resp transactionsResponse
+	decodeBody(t, rec, &resp)
+	if resp.Address != testAddress || len(resp.Transactions) != 1 || resp.Transactions[0].Hash != "0xaa" {
+		t.Errorf("unexpected response %+v", resp)
+	}
+
+	for _, target := range []string{
+		"/transactions",
+		"/transactions?address=0xnope",
+		"/transactions?address=" + testAddress + "&limit=many",
+		"/transactions?address=" + testAddress + "&direction=sideways",
+	} {
+		if rec := serve(s, http.MethodGet, target, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", target, rec.Code)
+		}
+	}
+}
+
+func TestHandleSubscribe(t *testing.T) {
+	s, _, _ := newTestServer(t)
+
+	rec := serve(s, http.MethodPost, "/subscribe", `{"address": "`+testAddress+`"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var resp subscribeResponse
+	decodeBody(t, rec, &resp)
+	if !resp.Subscribed || resp.Address != testAddress {
+		t.Errorf("unexpected response %+v", resp)
+	}
+
+	if rec := serve(s, http.MethodDelete, "/subscribe?address="+testAddress, ""); rec.Code != http.StatusOK {
+		t.Errorf("expected 200 on unsubscribe, got %d", rec.Code)
+	}
+	if rec := serve(s, http.MethodDelete, "/subscribe?address="+testAddress, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 unsubscribing twice, got %d", rec.Code)
+	}
+
+	for _, c := range []struct {
+		method, target, body string
+	}{
+		{http.MethodPost, "/subscribe", `not json`},
+		{http.MethodPost, "/subscribe", `{"address": "0xnope"}`},
+		{http.MethodPost, "/subscribe", `{"address": "` + testAddress + `", "from_block": -1}`},
+		{http.MethodDelete, "/subscribe?address=0xnope", ""},
+	} {
+		if rec := serve(s, c.method, c.target, c.body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s %s %s: expected 400, got %d", c.method, c.target, c.body, rec.Code)
+		}
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	s, rpc, _ := newTestServer(t)
+	rpc.Fail("eth_blockNumber", -32000, "unavailable")
+	// liveness never depends on the node
+	if rec := serve(s, http.MethodGet, "/healthz", ""); rec.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", rec.Code)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	s, rpc, _ := newTestServer(t)
+	serve(s, http.MethodPost, "/subscribe", `{"address": "`+testAddress+`"}`)
+	ready := serve(s, http.MethodGet, "/readyz", "")
+	if ready.Code != http.StatusOK {
+		t.Errorf("expected 200 while the node answers, got %d", ready.Code)
+	}
+	var status readyResponse
+	decodeBody(t, ready, &status)
+	if status.Status != "ok" || status.Parser.ActiveSubscriptions != 1 || status.Parser.LastRPCSuccessAt == nil {
+		t.Errorf("expected the parser status, got %+v", status)
+	}
+	rpc.Fail("eth_blockNumber", -32000, "unavailable")
+	rec := serve(s, http.MethodGet, "/readyz", "")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 once the node fails, got %d", rec.Code)
+	}
+	var resp errorResponse
+	decodeBody(t, rec, &resp)
+	if !strings.Contains(resp.Error, "unavailable") {
+		t.Errorf("expected the failure in the body, got %q", resp.Error)
+	}
+}
+
+func TestHandleStream(t *testing.T) {
+	rpc := testutil.NewServer(t)
+	mineBlocks(rpc)
+	s, _ := newParserServer(t, rpc, time.Millisecond)
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	if rec := serve(s, http.MethodGet, "/stream?address=0xnope", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid address, got %d", rec.Code)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/stream?address="+testAddress, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected an event stream, got %q", ct)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	received := false
+	for !received && scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var trans parser.Transaction
+		if err := json.Unmarshal([]byte(data), &trans); err != nil {
+			t.Fatalf("invalid event %q: %v", data, err)
+		}
+		if !strings.HasPrefix(trans.Hash, "0xaa") || trans.From != testAddress {
+			t.Errorf("unexpected transaction %+v", trans)
+		}
+		received = true
+	}
+	if !received {
+		t.Fatalf("expected a transaction event, got %v", scanner.Err())
+	}
+
+	// the subscription ends with the stream
+	cancel()
+	waitSubscriptions(t, s, 0)
+}
+
+func TestHandleStream_keepsOtherSubscriptions(t *testing.T) {
+	s, _, _ := newTestServer(t)
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	s.parser.Subscribe(testAddress)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/stream?address="+testAddress, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	cancel()
+
+	// the handler returns soon after the client goes away
+	time.Sleep(100 * time.Millisecond)
+	waitSubscriptions(t, s, 1)
+}
+
+func TestHandleWebSocket(t *testing.T) {
+	rpc := testutil.NewServer(t)
+	mineBlocks(rpc)
+	s, _ := newParserServer(t, rpc, time.Millisecond)
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	if rec := serve(s, http.MethodGet, "/ws?address=0xnope", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid address, got %d", rec.Code)
+	}
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws?address=" + testAddress
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var trans parser.Transaction
+	if err := conn.ReadJSON(&trans); err != nil {
+		t.Fatalf("expected a transaction message, got %v", err)
+	}
+	if !strings.HasPrefix(trans.Hash, "0xaa") || trans.From != testAddress {
+		t.Errorf("unexpected transaction %+v", trans)
+	}
+
+	// the subscription ends with the connection
+	conn.Close()
+	waitSubscriptions(t, s, 0)
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	s, _, _ := newTestServer(t,
+		WithAPIKeyAuth("secret"),
+		WithBearerAuth(func(token string) (bool, error) {
+			if token == "broken" {
+				return false, errors.New("validator is down")
+			}
+			return token == "token", nil
+		}),
+		WithPublicPaths("/block"),
+	)
+
+	cases := []struct {
+		name     string
+		path     string
+		header   string
+		value    string
+		expected int
+	}{
+		{"no credentials", "/status", "", "", http.StatusUnauthorized},
+		{"api key", "/status", "X-API-Key", "secret", http.StatusOK},
+		{"wrong api key", "/status", "X-API-Key", "guess", http.StatusUnauthorized},
+		{"bearer token", "/status", "Authorization", "Bearer token", http.StatusOK},
+		{"wrong bearer token", "/status", "Authorization", "Bearer guess", http.StatusUnauthorized},
+		{"failing validator", "/status", "Authorization", "Bearer broken", http.StatusUnauthorized},
+		{"not a bearer token", "/status", "Authorization", "token", http.StatusUnauthorized},
+		{"health probe", "/healthz", "", "", http.StatusOK},
+		{"custom public path", "/block", "", "", http.StatusOK},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, c.path, nil)
+		if c.header != "" {
+			req.Header.Set(c.header, c.value)
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != c.expected {
+			t.Errorf("%s: expected %d, got %d", c.name, c.expected, rec.Code)
+		}
+		if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("%s: expected a WWW-Authenticate challenge", c.name)
+		}
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	s, _, _ := newTestServer(t, WithAPIKeyAuth("secret", "other"), WithRateLimit(0.001, 2))
+	status := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/status", nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// unknown keys share the bucket of the IP instead of getting their own
+	for i, key := range []string{"guess-1", "guess-2"} {
+		if rec := status(key); rec.Code != http.StatusUnauthorized {
+			t.Errorf("request %d: expected 401, got %d", i, rec.Code)
+		}
+	}
+	rec := status("guess-3")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 once the IP bucket is empty, got %d", rec.Code)
+	}
+	if retryAfter, err := strconv.Atoi(rec.Header().Get("Retry-After")); err != nil || retryAfter < 1 {
+		t.Errorf("expected a Retry-After in seconds, got %q", rec.Header().Get("Retry-After"))
+	}
+
+	// valid keys have their own bucket
+	for i := 0; i < 2; i++ {
+		if rec := status("secret"); rec.Code != http.StatusOK {
+			t.Errorf("request %d: expected 200 with a valid key, got %d", i, rec.Code)
+		}
+	}
+	if rec := status("secret"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("expected 429 once the key bucket is empty, got %d", rec.Code)
+	}
+	if rec := status("other"); rec.Code != http.StatusOK {
+		t.Errorf("expected another key not to share the bucket, got %d", rec.Code)
+	}
+
+	// public paths are never limited
+	if rec := serve(s, http.MethodGet, "/healthz", ""); rec.Code != http.StatusOK {
+		t.Errorf("expected 200 on a public path, got %d", rec.Code)
+	}
+}
+
+func TestRequestIDReachesNode(t *testing.T) {
+	s, rpc, repo := newTestServer(t)
+	rpc.Result("eth_getTransactionByHash", map[string]string{"hash": "0xaa", "from": testAddress})
+	err := repo.CreateBlockTransactions(context.Background(), []*models.BlockTransaction{
+		{BlockAddress: testAddress, TransactionAddress: "0xaa", Direction: string(parser.Outgoing)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for target, method := range map[string]string{
+		"/block":                               "eth_blockNumber",
+		"/transactions?address=" + testAddress: "eth_getTransactionByHash",
+	} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("X-Request-ID", "req-"+method)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: expected 200, got %d", target, rec.Code)
+		}
+		calls := rpc.Calls(method)
+		if len(calls) == 0 || calls[len(calls)-1].Header.Get("X-Request-ID") != "req-"+method {
+			t.Errorf("%s: expected the request id to reach the node", target)
+		}
+	}
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	s, _, _ := newTestServer(t, WithLogger(zap.New(core)))
+
+	rec := serve(s, http.MethodGet, "/healthz", "")
+	id := rec.Header().Get("X-Request-ID")
+	if id == "" {
+		t.Fatal("expected a generated request id")
+	}
+	served := logs.FilterMessage("served request").All()
+	if len(served) != 1 || served[0].ContextMap()["request_id"] != id || served[0].ContextMap()["status"] != int64(http.StatusOK) {
+		t.Errorf("expected the request to be logged with its id and status, got %v", served)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	req.Header.Set("X-Request-ID", "client-id")
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Header().Get("X-Request-ID") != "client-id" {
+		t.Errorf("expected the id of the client to be echoed, got %q", rec.Header().Get("X-Request-ID"))
+	}
+	req.Header.Set("X-Request-ID", strings.Repeat("x", maxRequestIDLen+1))
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if id := rec.Header().Get("X-Request-ID"); len(id) > maxRequestIDLen {
+		t.Errorf("expected an oversized id to be replaced, got %d bytes", len(id))
+	}
+}
+
+func TestLoggingMiddleware_recover(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	s, _, _ := newTestServer(t, WithLogger(zap.New(core)))
+	handler := s.loggingMiddleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("boom")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/block", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500, got %d", rec.Code)
+	}
+	if n := logs.FilterMessage("panic while serving request").Len(); n != 1 {
+		t.Errorf("expected the panic to be logged, got %d entries", n)
+	}
+	served := logs.FilterMessage("served request").All()
+	if len(served) != 1 || served[0].ContextMap()["status"] != int64(http.StatusInternalServerError) {
+		t.Errorf("expected the request to be logged with status 500, got %v", served)
+	}
+
+	// http.ErrAbortHandler is left to net/http
+	abort := s.loggingMiddleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Errorf("expected http.ErrAbortHandler to be re-panicked, got %v", p)
+		}
+	}()
+	abort.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/block", nil))
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dungnh3/trustwallet-assignment/internal/utils"
+	"go.uber.org/zap"
+)
+
+// heartbeatInterval is how often a comment line is sent on idle streams so
+// proxies don't close the connection.
+const heartbeatInterval = 15 * time.Second
+
+// handleStream subscribes the address while the client is connected and
+// pushes every new transaction to it as a Server-Sent Event until it goes
+// away.
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	address := r.URL.Query().Get("address")
+	if !utils.IsHexAddress(address) {
+		s.writeError(w, http.StatusBadRequest, "invalid address")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	notifications, release := s.parser.Watch(address)
+	defer release()
+	defer s.subscribeStream(address)()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		case n, ok := <-notifications:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(n.Transaction)
+			if err != nil {
+				s.logger.Error("failed to encode transaction", zap.Error(err))
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
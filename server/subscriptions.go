@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/dungnh3/trustwallet-assignment/internal/parser"
+	"github.com/dungnh3/trustwallet-assignment/internal/utils"
+	"go.uber.org/zap"
+)
+
+// streamSubscriptions counts the open streams of each address, so that the
+// address is polled while at least one of them is open.
+type streamSubscriptions struct {
+	mutex sync.Mutex
+	refs  map[string]*streamSubscription
+}
+
+type streamSubscription struct {
+	streams int
+	// cancel ends the subscription, nil when the address was subscribed
+	// by someone else, e.g. POST /subscribe, and must stay so
+	cancel context.CancelFunc
+}
+
+// subscribeStream subscribes address for a stream unless already subscribed,
+// and returns the func releasing it once the stream ends. The subscription
+// ends with the last stream of the address that made it.
+func (s *Server) subscribeStream(address string) (release func()) {
+	address = utils.NormalizeAddress(address)
+	subs := &s.streamSubs
+	subs.mutex.Lock()
+	defer subs.mutex.Unlock()
+	sub, ok := subs.refs[address]
+	if !ok {
+		sub = &streamSubscription{}
+		ctx, cancel := context.WithCancel(context.Background())
+		_, err := s.parser.SubscribeE(ctx, address)
+		switch {
+		case err == nil:
+			sub.cancel = cancel
+		case errors.Is(err, parser.ErrAlreadySubscribed):
+			cancel()
+		default:
+			cancel()
+			s.logger.Error("failed to subscribe stream", zap.String("address", address), zap.Error(err))
+		}
+		subs.refs[address] = sub
+	}
+	sub.streams++
+
+	return sync.OnceFunc(func() {
+		subs.mutex.Lock()
+		defer subs.mutex.Unlock()
+		sub.streams--
+		if sub.streams > 0 {
+			return
+		}
+		if sub.cancel != nil {
+			sub.cancel()
+		}
+		delete(subs.refs, address)
+	})
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/dungnh3/trustwallet-assignment/internal/utils"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+const (
+	// wsWriteWait is the time allowed to write a message to the peer.
+	wsWriteWait = 10 * time.Second
+	// wsPongWait is the time allowed to read the next pong from the peer.
+	wsPongWait = 60 * time.Second
+	// wsPingPeriod must be less than wsPongWait.
+	wsPingPeriod = wsPongWait * 9 / 10
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// handleWebSocket subscribes the address while the connection is open and
+// pushes every new transaction to the client as a JSON message until either
+// side closes it.
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	address := r.URL.Query().Get("address")
+	if !utils.IsHexAddress(address) {
+		s.writeError(w, http.StatusBadRequest, "invalid address")
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade already replied to the client.
+		s.logger.Warn("failed to upgrade websocket", zap.Error(err))
+		return
+	}
+	defer conn.Close()
+
+	notifications, release := s.parser.Watch(address)
+	defer release()
+	defer s.subscribeStream(address)()
+
+	// The read loop handles pongs and close frames; it ends when the client
+	// goes away.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		conn.SetReadLimit(512)
+		_ = conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(wsPingPeriod)
+	defer ping.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-s.done:
+			_ = conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(wsWriteWait))
+			return
+		case n, ok := <-notifications:
+			if !ok {
+				_ = conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(wsWriteWait))
+				return
+			}
+			_ = conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteJSON(n.Transaction); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return
+			}
+		}
+	}
+}